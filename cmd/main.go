@@ -1,23 +1,72 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"net/url"
+	"os"
+	apiServer "simple_proxy/internal/apps/api"
 	proxyServer "simple_proxy/internal/apps/proxy"
+	"simple_proxy/internal/config"
+	apiDelivery "simple_proxy/internal/delivery/api"
 	proxyDelivery "simple_proxy/internal/delivery/proxy"
+	"simple_proxy/internal/repository/bolt"
+	"simple_proxy/internal/repository/memory"
+	"simple_proxy/internal/repository/mongo"
+	apiService "simple_proxy/internal/usecase/api"
 	proxyService "simple_proxy/internal/usecase/proxy"
 )
 
+type repository interface {
+	proxyService.Repository
+	apiService.Repository
+}
+
+func newRepository(cfg config.StorageConfig) (repository, error) {
+	storageURL, err := url.Parse(cfg.URI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage URI %q: %w", cfg.URI, err)
+	}
+
+	switch storageURL.Scheme {
+	case "memory":
+		log.Println("Using in-memory storage")
+		return memory.NewHTTPRepository(), nil
+	case "bolt":
+		path := storageURL.Host + storageURL.Path
+		log.Printf("Using embedded storage at %s", path)
+		return bolt.NewHTTPRepository(path)
+	case "mongodb", "mongodb+srv":
+		log.Printf("Connecting to MongoDB at %s, database: %s", cfg.URI, cfg.Database)
+		return mongo.NewHTTPRepository(cfg.URI, cfg.Database)
+	default:
+		return nil, fmt.Errorf("unsupported storage URI scheme %q", storageURL.Scheme)
+	}
+}
+
 func main() {
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load configuration: %v", err)
+	}
+
+	repo, err := newRepository(cfg.Storage)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to initialize repository: %v", err)
+	}
 
-	mongoURI := "mongodb://localhost:27017"
-	mongoDB := "proxy_db"
+	httpProxyService := proxyService.NewHttpProxyService(repo, cfg)
+	httpProxyDelivery := proxyDelivery.NewHttpProxyDelivery(httpProxyService, cfg.Proxy.CertHost)
 
-	log.Printf("Connecting to MongoDB at %s, database: %s", mongoURI, mongoDB)
+	server := proxyServer.NewHttpProxyServer(httpProxyDelivery, cfg.Proxy.Addr)
 
-	httpProxyService := proxyService.NewHttpProxyService(mongoURI, mongoDB)
-	httpProxyDelivery := proxyDelivery.NewHttpProxyDelivery(httpProxyService)
+	if cfg.API.Enabled {
+		httpApiService := apiService.NewApiService(repo)
+		httpApiDelivery := apiDelivery.NewApiDelivery(httpApiService, httpProxyService)
 
-	server := proxyServer.NewHttpProxyServer(httpProxyDelivery)
+		api := apiServer.NewApiServer(httpApiDelivery, cfg.API.Addr)
+		go api.Run()
+	}
 
 	server.Run()
 }
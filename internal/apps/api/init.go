@@ -0,0 +1,50 @@
+package api
+
+import (
+	"log"
+	"net/http"
+)
+
+type ApiDelivery interface {
+	ListRequests(w http.ResponseWriter, r *http.Request)
+	GetRequest(w http.ResponseWriter, r *http.Request)
+	GetResponse(w http.ResponseWriter, r *http.Request)
+	ListWebSocketMessages(w http.ResponseWriter, r *http.Request)
+	Repeat(w http.ResponseWriter, r *http.Request)
+	StartScan(w http.ResponseWriter, r *http.Request)
+	GetScan(w http.ResponseWriter, r *http.Request)
+}
+
+type ApiServer struct {
+	delivery ApiDelivery
+	addr     string
+}
+
+func NewApiServer(delivery ApiDelivery, addr string) *ApiServer {
+	return &ApiServer{
+		delivery: delivery,
+		addr:     addr,
+	}
+}
+
+func (a *ApiServer) Run() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /requests", a.delivery.ListRequests)
+	mux.HandleFunc("GET /requests/{id}", a.delivery.GetRequest)
+	mux.HandleFunc("GET /requests/{id}/messages", a.delivery.ListWebSocketMessages)
+	mux.HandleFunc("GET /responses/{id}", a.delivery.GetResponse)
+	mux.HandleFunc("POST /repeat/{id}", a.delivery.Repeat)
+	mux.HandleFunc("POST /scan/{id}", a.delivery.StartScan)
+	mux.HandleFunc("GET /scans/{id}", a.delivery.GetScan)
+
+	server := &http.Server{
+		Addr:    a.addr,
+		Handler: mux,
+	}
+
+	log.Printf("Starting API server on %s", a.addr)
+
+	if err := server.ListenAndServe(); err != nil {
+		log.Fatalf("API ListenAndServe error: %v", err)
+	}
+}
@@ -11,11 +11,13 @@ type HttpProxyDelivery interface {
 
 type HttpProxyServer struct {
 	delivery HttpProxyDelivery
+	addr     string
 }
 
-func NewHttpProxyServer(delivery HttpProxyDelivery) *HttpProxyServer {
+func NewHttpProxyServer(delivery HttpProxyDelivery, addr string) *HttpProxyServer {
 	return &HttpProxyServer{
 		delivery: delivery,
+		addr:     addr,
 	}
 }
 
@@ -23,11 +25,11 @@ func (h *HttpProxyServer) Run() {
 	handler := http.HandlerFunc(h.delivery.HandleProxy)
 
 	server := &http.Server{
-		Addr:    ":8080",
+		Addr:    h.addr,
 		Handler: handler,
 	}
 
-	log.Println("Starting server on :8080")
+	log.Printf("Starting server on %s", h.addr)
 
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("ListenAndServe error: %v", err)
@@ -0,0 +1,319 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigPath = "config.yaml"
+
+type Config struct {
+	Proxy    ProxyConfig    `yaml:"proxy"`
+	API      APIConfig      `yaml:"api"`
+	Storage  StorageConfig  `yaml:"storage"`
+	TLS      TLSConfig      `yaml:"tls"`
+	Upstream UpstreamConfig `yaml:"upstream"`
+	Miner    MinerConfig    `yaml:"miner"`
+}
+
+// ProxyConfig.CertHost is the hostname the proxy answers itself with the
+// CA download page instead of forwarding. ResponseEncoding decides what the
+// client receives for compressed responses: "preserve" forwards the upstream
+// bytes unchanged, "decode" sends them decompressed and "reencode"
+// decompresses them for rewriting and compresses them again.
+type ProxyConfig struct {
+	Addr             string `yaml:"addr"`
+	CertHost         string `yaml:"cert_host"`
+	ResponseEncoding string `yaml:"response_encoding"`
+}
+
+type APIConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Addr    string `yaml:"addr"`
+}
+
+// StorageConfig selects the backend by URI scheme: mongodb://, memory:// or
+// bolt://<path>. BodyLimit caps the bytes stored per body, 0 stores bodies
+// whole.
+type StorageConfig struct {
+	URI       string `yaml:"uri"`
+	Database  string `yaml:"database"`
+	BodyLimit int64  `yaml:"body_limit"`
+}
+
+// TLSConfig points at the interception CA. When both files are missing a
+// new CA named CAName is generated and written there.
+type TLSConfig struct {
+	CACert     string        `yaml:"ca_cert"`
+	CAKey      string        `yaml:"ca_key"`
+	CAName     string        `yaml:"ca_name"`
+	CAValidity time.Duration `yaml:"ca_validity"`
+
+	LeafKey     string `yaml:"leaf_key"`      // "rsa" or "ecdsa" (P-256)
+	KeyPoolSize int    `yaml:"key_pool_size"` // leaf keys generated ahead of time
+
+	CertCacheSize int    `yaml:"cert_cache_size"` // leaf certificates kept in memory
+	CertCacheDir  string `yaml:"cert_cache_dir"`  // persist leaf certificates here when set
+
+	// Passthrough hosts are tunneled without interception. Entries are exact
+	// hosts, wildcards such as *.example.com, or regular expressions
+	// prefixed with "re:".
+	Passthrough []string `yaml:"passthrough"`
+	// After AutoPassthroughFailures failed client handshakes in a row a host
+	// is passed through for AutoPassthroughTTL. Zero disables it.
+	AutoPassthroughFailures int           `yaml:"auto_passthrough_failures"`
+	AutoPassthroughTTL      time.Duration `yaml:"auto_passthrough_ttl"`
+}
+
+// UpstreamConfig tunes the transport shared by forwarding, repeats, scans
+// and tunnels. Timeout covers a whole exchange including the body, so it is
+// off by default to let long downloads stream; MaxConnsPerHost of 0 means
+// no limit.
+type UpstreamConfig struct {
+	Timeout               time.Duration `yaml:"timeout"`
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	TLSHandshakeTimeout   time.Duration `yaml:"tls_handshake_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	IdleConnTimeout       time.Duration `yaml:"idle_conn_timeout"`
+
+	MaxIdleConns        int `yaml:"max_idle_conns"`
+	MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host"`
+	MaxConnsPerHost     int `yaml:"max_conns_per_host"`
+}
+
+type MinerConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Wordlist    string `yaml:"wordlist"`
+	Baselines   int    `yaml:"baselines"`
+	LengthDelta int    `yaml:"length_delta"`
+	WordDelta   int    `yaml:"word_delta"`
+}
+
+func Default() *Config {
+	return &Config{
+		Proxy: ProxyConfig{
+			Addr:             ":8080",
+			CertHost:         "proxy.local",
+			ResponseEncoding: "preserve",
+		},
+		API: APIConfig{
+			Enabled: true,
+			Addr:    "127.0.0.1:8081",
+		},
+		Storage: StorageConfig{
+			URI:       "mongodb://localhost:27017",
+			Database:  "proxy_db",
+			BodyLimit: 8 << 20,
+		},
+		TLS: TLSConfig{
+			CACert:     "ca.crt",
+			CAKey:      "ca.key",
+			CAName:     "simple_proxy CA",
+			CAValidity: 10 * 365 * 24 * time.Hour,
+
+			LeafKey:     "rsa",
+			KeyPoolSize: 8,
+
+			CertCacheSize: 1024,
+
+			AutoPassthroughFailures: 3,
+			AutoPassthroughTTL:      30 * time.Minute,
+		},
+		Upstream: UpstreamConfig{
+			DialTimeout:           10 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ResponseHeaderTimeout: 30 * time.Second,
+			IdleConnTimeout:       90 * time.Second,
+
+			MaxIdleConns:        256,
+			MaxIdleConnsPerHost: 16,
+			MaxConnsPerHost:     64,
+		},
+		Miner: MinerConfig{
+			Enabled:     true,
+			Wordlist:    "params.txt",
+			Baselines:   3,
+			LengthDelta: 16,
+			WordDelta:   2,
+		},
+	}
+}
+
+// Load builds the configuration from defaults, then the YAML file, then
+// environment variables and finally command line flags, each overriding the
+// previous one.
+func Load(args []string) (*Config, error) {
+	flags := newFlagSet()
+	err := flags.fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	path, explicit := *flags.configPath, true
+	if path == "" {
+		path = os.Getenv("PROXY_CONFIG")
+	}
+	if path == "" {
+		path, explicit = defaultConfigPath, false
+	}
+
+	err = loadFile(cfg, path, explicit)
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyEnv(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, apply := range flags.pending {
+		apply(cfg)
+	}
+
+	return cfg, nil
+}
+
+func loadFile(cfg *Config, path string, explicit bool) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	err = yaml.Unmarshal(data, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+func applyEnv(cfg *Config) error {
+	// Order matters: STORAGE_URI wins over MONGO_URI, which docker-compose sets.
+	stringVars := []struct {
+		name  string
+		field *string
+	}{
+		{"PROXY_ADDR", &cfg.Proxy.Addr},
+		{"PROXY_CERT_HOST", &cfg.Proxy.CertHost},
+		{"RESPONSE_ENCODING", &cfg.Proxy.ResponseEncoding},
+		{"API_ADDR", &cfg.API.Addr},
+		{"MONGO_URI", &cfg.Storage.URI},
+		{"STORAGE_URI", &cfg.Storage.URI},
+		{"MONGO_DB", &cfg.Storage.Database},
+		{"CA_CERT", &cfg.TLS.CACert},
+		{"CA_KEY", &cfg.TLS.CAKey},
+		{"CA_NAME", &cfg.TLS.CAName},
+		{"LEAF_KEY", &cfg.TLS.LeafKey},
+		{"CERT_CACHE_DIR", &cfg.TLS.CertCacheDir},
+		{"WORDLIST", &cfg.Miner.Wordlist},
+	}
+	listVars := map[string]*[]string{
+		"TLS_PASSTHROUGH": &cfg.TLS.Passthrough,
+	}
+	durationVars := map[string]*time.Duration{
+		"UPSTREAM_TIMEOUT":        &cfg.Upstream.Timeout,
+		"DIAL_TIMEOUT":            &cfg.Upstream.DialTimeout,
+		"TLS_HANDSHAKE_TIMEOUT":   &cfg.Upstream.TLSHandshakeTimeout,
+		"RESPONSE_HEADER_TIMEOUT": &cfg.Upstream.ResponseHeaderTimeout,
+		"IDLE_CONN_TIMEOUT":       &cfg.Upstream.IdleConnTimeout,
+		"CA_VALIDITY":             &cfg.TLS.CAValidity,
+		"AUTO_PASSTHROUGH_TTL":    &cfg.TLS.AutoPassthroughTTL,
+	}
+	intVars := map[string]*int{
+		"KEY_POOL_SIZE":             &cfg.TLS.KeyPoolSize,
+		"CERT_CACHE_SIZE":           &cfg.TLS.CertCacheSize,
+		"AUTO_PASSTHROUGH_FAILURES": &cfg.TLS.AutoPassthroughFailures,
+		"MAX_IDLE_CONNS":            &cfg.Upstream.MaxIdleConns,
+		"MAX_IDLE_CONNS_PER_HOST":   &cfg.Upstream.MaxIdleConnsPerHost,
+		"MAX_CONNS_PER_HOST":        &cfg.Upstream.MaxConnsPerHost,
+		"MINER_BASELINES":           &cfg.Miner.Baselines,
+		"MINER_LENGTH_DELTA":        &cfg.Miner.LengthDelta,
+		"MINER_WORD_DELTA":          &cfg.Miner.WordDelta,
+	}
+	int64Vars := map[string]*int64{
+		"BODY_LIMIT": &cfg.Storage.BodyLimit,
+	}
+	boolVars := map[string]*bool{
+		"API_ENABLED":   &cfg.API.Enabled,
+		"MINER_ENABLED": &cfg.Miner.Enabled,
+	}
+
+	for _, v := range stringVars {
+		if value, ok := os.LookupEnv(v.name); ok {
+			*v.field = value
+		}
+	}
+
+	for name, field := range listVars {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = splitList(value)
+		}
+	}
+
+	for name, field := range durationVars {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = d
+		}
+	}
+
+	for name, field := range intVars {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = n
+		}
+	}
+
+	for name, field := range int64Vars {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = n
+		}
+	}
+
+	for name, field := range boolVars {
+		if value, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*field = b
+		}
+	}
+
+	return nil
+}
+
+// splitList parses comma separated values, dropping empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(data), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeConfig(t, `
+proxy:
+  addr: ":1111"
+tls:
+  key_pool_size: 4
+  cert_cache_size: 10
+  auto_passthrough_failures: 7
+upstream:
+  max_conns_per_host: 5
+  idle_conn_timeout: 1m
+miner:
+  baselines: 2
+`)
+
+	t.Setenv("KEY_POOL_SIZE", "6")
+	t.Setenv("CERT_CACHE_SIZE", "20")
+	t.Setenv("IDLE_CONN_TIMEOUT", "2m")
+	t.Setenv("MINER_LENGTH_DELTA", "40")
+	t.Setenv("MONGO_URI", "mongodb://compose:27017")
+	t.Setenv("STORAGE_URI", "memory://")
+
+	cfg, err := Load([]string{
+		"-config", path,
+		"-proxy-addr", ":2222",
+		"-key-pool-size", "9",
+		"-max-idle-conns-per-host", "3",
+		"-miner-word-delta", "5",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defaults := Default()
+	tests := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{name: "flag over env and file", got: cfg.TLS.KeyPoolSize, want: 9},
+		{name: "flag over file", got: cfg.Proxy.Addr, want: ":2222"},
+		{name: "flag over default", got: cfg.Upstream.MaxIdleConnsPerHost, want: 3},
+		{name: "env over file", got: cfg.TLS.CertCacheSize, want: 20},
+		{name: "env duration over file", got: cfg.Upstream.IdleConnTimeout, want: 2 * time.Minute},
+		{name: "env over default", got: cfg.Miner.LengthDelta, want: 40},
+		{name: "STORAGE_URI over MONGO_URI", got: cfg.Storage.URI, want: "memory://"},
+		{name: "file over default", got: cfg.TLS.AutoPassthroughFailures, want: 7},
+		{name: "file only", got: cfg.Upstream.MaxConnsPerHost, want: 5},
+		{name: "file miner threshold", got: cfg.Miner.Baselines, want: 2},
+		{name: "flag miner threshold", got: cfg.Miner.WordDelta, want: 5},
+		{name: "default", got: cfg.Upstream.MaxIdleConns, want: defaults.Upstream.MaxIdleConns},
+	}
+
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	path := writeConfig(t, "")
+
+	for name, value := range map[string]string{
+		"MAX_CONNS_PER_HOST": "many",
+		"BODY_LIMIT":         "1MB",
+		"IDLE_CONN_TIMEOUT":  "90",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			_, err := Load([]string{"-config", path})
+			if err == nil {
+				t.Errorf("%s=%q was accepted", name, value)
+			}
+		})
+	}
+}
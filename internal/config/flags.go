@@ -0,0 +1,118 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"time"
+)
+
+// flagSet records explicitly passed flags so they can be applied on top of
+// the file and environment once those are loaded.
+type flagSet struct {
+	fs         *flag.FlagSet
+	configPath *string
+	pending    []func(*Config)
+}
+
+func newFlagSet() *flagSet {
+	f := &flagSet{
+		fs: flag.NewFlagSet(os.Args[0], flag.ExitOnError),
+	}
+
+	f.configPath = f.fs.String("config", "", "path to YAML config file (default config.yaml if present)")
+
+	f.string("proxy-addr", "proxy listen address", func(c *Config) *string { return &c.Proxy.Addr })
+	f.string("cert-host", "hostname serving the CA download page", func(c *Config) *string { return &c.Proxy.CertHost })
+	f.string("response-encoding", "compressed responses sent to clients: preserve, decode or reencode", func(c *Config) *string { return &c.Proxy.ResponseEncoding })
+	f.string("api-addr", "API listen address", func(c *Config) *string { return &c.API.Addr })
+	f.string("storage-uri", "storage URI: mongodb://..., memory:// or bolt://<path>", func(c *Config) *string { return &c.Storage.URI })
+	f.string("storage-db", "MongoDB database name", func(c *Config) *string { return &c.Storage.Database })
+	f.int64("body-limit", "maximum bytes stored per body, 0 for no limit", func(c *Config) *int64 { return &c.Storage.BodyLimit })
+	f.string("ca-cert", "CA certificate path", func(c *Config) *string { return &c.TLS.CACert })
+	f.string("ca-key", "CA private key path", func(c *Config) *string { return &c.TLS.CAKey })
+	f.string("ca-name", "common name of a generated CA", func(c *Config) *string { return &c.TLS.CAName })
+	f.string("leaf-key", "leaf certificate key type: rsa or ecdsa", func(c *Config) *string { return &c.TLS.LeafKey })
+	f.int("key-pool-size", "leaf keys generated ahead of time", func(c *Config) *int { return &c.TLS.KeyPoolSize })
+	f.int("cert-cache-size", "leaf certificates kept in memory", func(c *Config) *int { return &c.TLS.CertCacheSize })
+	f.string("cert-cache-dir", "directory persisting minted leaf certificates", func(c *Config) *string { return &c.TLS.CertCacheDir })
+	f.list("passthrough", "comma separated hosts tunneled without interception", func(c *Config) *[]string { return &c.TLS.Passthrough })
+	f.int("auto-passthrough-failures", "failed client handshakes in a row before a host is passed through, 0 disables", func(c *Config) *int { return &c.TLS.AutoPassthroughFailures })
+	f.duration("auto-passthrough-ttl", "how long a host stays passed through after failed handshakes", func(c *Config) *time.Duration { return &c.TLS.AutoPassthroughTTL })
+	f.duration("ca-validity", "validity of a generated CA", func(c *Config) *time.Duration { return &c.TLS.CAValidity })
+	f.string("wordlist", "param-miner wordlist path", func(c *Config) *string { return &c.Miner.Wordlist })
+	f.int("miner-baselines", "baseline requests per param-miner scan", func(c *Config) *int { return &c.Miner.Baselines })
+	f.int("miner-length-delta", "body length change in bytes tolerated by the param-miner", func(c *Config) *int { return &c.Miner.LengthDelta })
+	f.int("miner-word-delta", "word count change tolerated by the param-miner", func(c *Config) *int { return &c.Miner.WordDelta })
+	f.duration("upstream-timeout", "upstream request timeout", func(c *Config) *time.Duration { return &c.Upstream.Timeout })
+	f.duration("dial-timeout", "upstream dial timeout", func(c *Config) *time.Duration { return &c.Upstream.DialTimeout })
+	f.duration("tls-handshake-timeout", "upstream TLS handshake timeout", func(c *Config) *time.Duration { return &c.Upstream.TLSHandshakeTimeout })
+	f.duration("response-header-timeout", "time to wait for upstream response headers", func(c *Config) *time.Duration { return &c.Upstream.ResponseHeaderTimeout })
+	f.duration("idle-conn-timeout", "how long idle upstream connections are kept", func(c *Config) *time.Duration { return &c.Upstream.IdleConnTimeout })
+	f.int("max-idle-conns", "idle upstream connections kept in total", func(c *Config) *int { return &c.Upstream.MaxIdleConns })
+	f.int("max-idle-conns-per-host", "idle upstream connections kept per host", func(c *Config) *int { return &c.Upstream.MaxIdleConnsPerHost })
+	f.int("max-conns-per-host", "upstream connections per host, 0 for no limit", func(c *Config) *int { return &c.Upstream.MaxConnsPerHost })
+	f.bool("api", "enable the API server", func(c *Config) *bool { return &c.API.Enabled })
+	f.bool("miner", "enable param-miner scans", func(c *Config) *bool { return &c.Miner.Enabled })
+
+	return f
+}
+
+func (f *flagSet) string(name, usage string, field func(*Config) *string) {
+	f.fs.Func(name, usage, func(value string) error {
+		f.pending = append(f.pending, func(c *Config) { *field(c) = value })
+		return nil
+	})
+}
+
+func (f *flagSet) list(name, usage string, field func(*Config) *[]string) {
+	f.fs.Func(name, usage, func(value string) error {
+		list := splitList(value)
+		f.pending = append(f.pending, func(c *Config) { *field(c) = list })
+		return nil
+	})
+}
+
+func (f *flagSet) duration(name, usage string, field func(*Config) *time.Duration) {
+	f.fs.Func(name, usage, func(value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		f.pending = append(f.pending, func(c *Config) { *field(c) = d })
+		return nil
+	})
+}
+
+func (f *flagSet) int(name, usage string, field func(*Config) *int) {
+	f.fs.Func(name, usage, func(value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		f.pending = append(f.pending, func(c *Config) { *field(c) = n })
+		return nil
+	})
+}
+
+func (f *flagSet) int64(name, usage string, field func(*Config) *int64) {
+	f.fs.Func(name, usage, func(value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.pending = append(f.pending, func(c *Config) { *field(c) = n })
+		return nil
+	})
+}
+
+func (f *flagSet) bool(name, usage string, field func(*Config) *bool) {
+	f.fs.BoolFunc(name, usage, func(value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		f.pending = append(f.pending, func(c *Config) { *field(c) = b })
+		return nil
+	})
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"simple_proxy/internal/model"
+	"strconv"
+)
+
+type ApiService interface {
+	ListRequests(ctx context.Context, filter model.RequestFilter, page, limit int64) (*model.HTTPRequestPage, error)
+	GetTransaction(ctx context.Context, requestID string) (*model.HTTPTransaction, error)
+	GetResponse(ctx context.Context, responseID string) (*model.HTTPResponse, error)
+	ListWebSocketMessages(ctx context.Context, requestID string) ([]model.WebSocketMessage, error)
+}
+
+type ProxyService interface {
+	Repeat(ctx context.Context, requestID string) (*model.HTTPTransaction, error)
+	StartScan(ctx context.Context, requestID, location string) (*model.ScanJob, error)
+	GetScan(ctx context.Context, jobID string) (*model.ScanJob, error)
+}
+
+type ApiDelivery struct {
+	apiService   ApiService
+	proxyService ProxyService
+}
+
+func NewApiDelivery(service ApiService, proxyService ProxyService) *ApiDelivery {
+	return &ApiDelivery{
+		apiService:   service,
+		proxyService: proxyService,
+	}
+}
+
+func (a *ApiDelivery) ListRequests(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.ParseInt(r.URL.Query().Get("page"), 10, 64)
+	limit, _ := strconv.ParseInt(r.URL.Query().Get("limit"), 10, 64)
+
+	filter := model.RequestFilter{
+		Method: r.URL.Query().Get("method"),
+		Host:   r.URL.Query().Get("host"),
+	}
+
+	result, err := a.apiService.ListRequests(r.Context(), filter, page, limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (a *ApiDelivery) GetRequest(w http.ResponseWriter, r *http.Request) {
+	transaction, err := a.apiService.GetTransaction(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transaction)
+}
+
+func (a *ApiDelivery) GetResponse(w http.ResponseWriter, r *http.Request) {
+	response, err := a.apiService.GetResponse(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *ApiDelivery) ListWebSocketMessages(w http.ResponseWriter, r *http.Request) {
+	messages, err := a.apiService.ListWebSocketMessages(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, messages)
+}
+
+func (a *ApiDelivery) Repeat(w http.ResponseWriter, r *http.Request) {
+	transaction, err := a.proxyService.Repeat(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, transaction)
+}
+
+func (a *ApiDelivery) StartScan(w http.ResponseWriter, r *http.Request) {
+	job, err := a.proxyService.StartScan(r.Context(), r.PathValue("id"), r.URL.Query().Get("location"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+func (a *ApiDelivery) GetScan(w http.ResponseWriter, r *http.Request) {
+	job, err := a.proxyService.GetScan(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, job)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	err := json.NewEncoder(w).Encode(v)
+	if err != nil {
+		log.Printf("Error encoding API response: %v\n", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, model.ErrInvalidID), errors.Is(err, model.ErrUnsupported):
+		status = http.StatusBadRequest
+	default:
+		log.Printf("API error: %v\n", err)
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const certLandingPage = `<!DOCTYPE html>
+<html>
+<head><title>Proxy CA certificate</title></head>
+<body>
+<h1>Proxy CA certificate</h1>
+<p>Install this certificate as a trusted root to inspect HTTPS traffic going through the proxy.</p>
+<ul>
+<li><a href="/cert.pem">PEM</a> - browsers, Linux, macOS</li>
+<li><a href="/cert.der">DER</a> - Windows, Android, iOS</li>
+</ul>
+</body>
+</html>
+`
+
+// isCertRequest matches requests for the configured cert host as well as
+// requests sent to the proxy port directly instead of through it.
+func (h *HttpProxyDelivery) isCertRequest(r *http.Request) bool {
+	if !r.URL.IsAbs() {
+		return true
+	}
+
+	host := r.Host
+	if hostOnly, _, err := net.SplitHostPort(host); err == nil {
+		host = hostOnly
+	}
+
+	return h.certHost != "" && strings.EqualFold(host, h.certHost)
+}
+
+func (h *HttpProxyDelivery) serveCertificate(w http.ResponseWriter, r *http.Request) {
+	der := h.proxyService.CACertificate()
+
+	switch r.URL.Path {
+	case "/cert", "/cert.pem":
+		w.Header().Set("Content-Type", "application/x-pem-file")
+		w.Header().Set("Content-Disposition", `attachment; filename="proxy-ca.pem"`)
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	case "/cert.der", "/cert.crt":
+		w.Header().Set("Content-Type", "application/x-x509-ca-cert")
+		w.Header().Set("Content-Disposition", `attachment; filename="proxy-ca.crt"`)
+		w.Write(der)
+	case "/":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, certLandingPage)
+	default:
+		http.NotFound(w, r)
+	}
+}
@@ -7,15 +7,18 @@ import (
 type ProxyService interface {
 	HandleHTTPRequest(w http.ResponseWriter, r *http.Request)
 	HandleConnect(w http.ResponseWriter, r *http.Request)
+	CACertificate() []byte
 }
 
 type HttpProxyDelivery struct {
 	proxyService ProxyService
+	certHost     string
 }
 
-func NewHttpProxyDelivery(service ProxyService) *HttpProxyDelivery {
+func NewHttpProxyDelivery(service ProxyService, certHost string) *HttpProxyDelivery {
 	return &HttpProxyDelivery{
 		proxyService: service,
+		certHost:     certHost,
 	}
 }
 
@@ -25,5 +28,10 @@ func (h *HttpProxyDelivery) HandleProxy(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if h.isCertRequest(r) {
+		h.serveCertificate(w, r)
+		return
+	}
+
 	h.proxyService.HandleHTTPRequest(w, r)
 }
@@ -0,0 +1,32 @@
+package model
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// TextView decodes a body with the charset detected at capture time.
+// Bodies without a charset are binary and have no text view.
+func TextView(body []byte, charsetName string) string {
+	if charsetName == "" || len(body) == 0 {
+		return ""
+	}
+
+	if charsetName == "utf-8" {
+		return strings.ToValidUTF8(string(body), string(utf8.RuneError))
+	}
+
+	encoding, _ := charset.Lookup(charsetName)
+	if encoding == nil {
+		return strings.ToValidUTF8(string(body), string(utf8.RuneError))
+	}
+
+	decoded, err := encoding.NewDecoder().Bytes(body)
+	if err != nil {
+		return strings.ToValidUTF8(string(body), string(utf8.RuneError))
+	}
+
+	return string(decoded)
+}
@@ -0,0 +1,9 @@
+package model
+
+import "errors"
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrInvalidID   = errors.New("invalid ID")
+	ErrUnsupported = errors.New("unsupported")
+)
@@ -1,18 +1,19 @@
 package model
 
 import (
-	"errors"
+	"fmt"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func StringToObjectID(id string) (primitive.ObjectID, error) {
 	if id == "" {
-		return primitive.NilObjectID, errors.New("empty ID string")
+		return primitive.NilObjectID, fmt.Errorf("%w: empty ID string", ErrInvalidID)
 	}
 
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		return primitive.NilObjectID, err
+		return primitive.NilObjectID, fmt.Errorf("%w: %v", ErrInvalidID, err)
 	}
 
 	return objectID, nil
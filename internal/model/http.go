@@ -6,35 +6,72 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// HTTPRequest and HTTPResponse keep bodies as raw bytes, base64 encoded in
+// JSON. BodyText is a UTF-8 view of text-like bodies decoded from Charset;
+// binary bodies have neither. Encodings lists the Content-Encoding codings
+// that were removed before storing the body.
 type HTTPRequest struct {
-	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
-	Method      string              `bson:"method" json:"method"`
-	Path        string              `bson:"path" json:"path"`
-	QueryParams map[string][]string `bson:"query_params" json:"query_params"`
-	Headers     map[string][]string `bson:"headers" json:"headers"`
-	Cookies     map[string]string   `bson:"cookies" json:"cookies"`
-	Body        string              `bson:"body" json:"body"`
-	FormParams  map[string][]string `bson:"form_params,omitempty" json:"form_params,omitempty"`
-	IsGzipped   bool                `bson:"is_gzipped" json:"is_gzipped"`
-	TargetHost  string              `bson:"target_host" json:"target_host"`
-	ClientIP    string              `bson:"client_ip" json:"client_ip"`
-	Timestamp   time.Time           `bson:"timestamp" json:"timestamp"`
-	ResponseID  primitive.ObjectID  `bson:"response_id,omitempty" json:"response_id,omitempty"`
+	ID                primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	Method            string              `bson:"method" json:"method"`
+	Scheme            string              `bson:"scheme" json:"scheme"`
+	Proto             string              `bson:"proto" json:"proto"`
+	Path              string              `bson:"path" json:"path"`
+	RawPath           string              `bson:"raw_path,omitempty" json:"raw_path,omitempty"`
+	RawQuery          string              `bson:"raw_query,omitempty" json:"raw_query,omitempty"`
+	QueryParams       map[string][]string `bson:"query_params" json:"query_params"`
+	Headers           map[string][]string `bson:"headers" json:"headers"`
+	Cookies           map[string]string   `bson:"cookies" json:"cookies"`
+	Body              []byte              `bson:"body,omitempty" json:"body,omitempty"`
+	BodyText          string              `bson:"-" json:"body_text,omitempty"`
+	Charset           string              `bson:"charset,omitempty" json:"charset,omitempty"`
+	BodyHash          string              `bson:"body_hash,omitempty" json:"body_hash,omitempty"`
+	BodyPreview       string              `bson:"body_preview,omitempty" json:"body_preview,omitempty"`
+	BodySize          int64               `bson:"body_size" json:"body_size"`
+	BodyTruncated     bool                `bson:"body_truncated,omitempty" json:"body_truncated,omitempty"`
+	FormParams        map[string][]string `bson:"form_params,omitempty" json:"form_params,omitempty"`
+	IsGzipped         bool                `bson:"is_gzipped" json:"is_gzipped"`
+	Encodings         []string            `bson:"encodings,omitempty" json:"encodings,omitempty"`
+	TargetHost        string              `bson:"target_host" json:"target_host"`
+	ClientIP          string              `bson:"client_ip" json:"client_ip"`
+	Timestamp         time.Time           `bson:"timestamp" json:"timestamp"`
+	ResponseID        primitive.ObjectID  `bson:"response_id,omitempty" json:"response_id,omitempty"`
+	OriginalRequestID primitive.ObjectID  `bson:"original_request_id,omitempty" json:"original_request_id,omitempty"`
+	Tunnel            *TunnelStats        `bson:"tunnel,omitempty" json:"tunnel,omitempty"`
 }
 
 type HTTPResponse struct {
 	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
 	RequestID     primitive.ObjectID  `bson:"request_id" json:"request_id"`
 	StatusCode    int                 `bson:"status_code" json:"status_code"`
+	Proto         string              `bson:"proto" json:"proto"`
 	Headers       map[string][]string `bson:"headers" json:"headers"`
-	Body          string              `bson:"body" json:"body"`
+	Body          []byte              `bson:"body,omitempty" json:"body,omitempty"`
+	BodyText      string              `bson:"-" json:"body_text,omitempty"`
+	Charset       string              `bson:"charset,omitempty" json:"charset,omitempty"`
+	BodyHash      string              `bson:"body_hash,omitempty" json:"body_hash,omitempty"`
+	BodyPreview   string              `bson:"body_preview,omitempty" json:"body_preview,omitempty"`
+	BodySize      int64               `bson:"body_size" json:"body_size"`
+	BodyTruncated bool                `bson:"body_truncated,omitempty" json:"body_truncated,omitempty"`
 	IsGzipped     bool                `bson:"is_gzipped" json:"is_gzipped"`
+	Encodings     []string            `bson:"encodings,omitempty" json:"encodings,omitempty"`
 	ContentType   string              `bson:"content_type" json:"content_type"`
 	ContentLength int64               `bson:"content_length" json:"content_length"`
 	Timestamp     time.Time           `bson:"timestamp" json:"timestamp"`
 }
 
 type HTTPTransaction struct {
-	Request  HTTPRequest  `bson:"request" json:"request"`
-	Response HTTPResponse `bson:"response" json:"response"`
+	Request  HTTPRequest   `bson:"request" json:"request"`
+	Response *HTTPResponse `bson:"response,omitempty" json:"response,omitempty"`
+}
+
+type HTTPRequestPage struct {
+	Requests []HTTPRequest `json:"requests"`
+	Total    int64         `json:"total"`
+	Page     int64         `json:"page"`
+	Limit    int64         `json:"limit"`
+}
+
+type RequestFilter struct {
+	Method string
+	Host   string
 }
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ScanStatus string
+
+const (
+	ScanPending ScanStatus = "pending"
+	ScanRunning ScanStatus = "running"
+	ScanDone    ScanStatus = "done"
+	ScanFailed  ScanStatus = "failed"
+)
+
+type ParamLocation string
+
+const (
+	ParamQuery  ParamLocation = "query"
+	ParamForm   ParamLocation = "form"
+	ParamJSON   ParamLocation = "json"
+	ParamCookie ParamLocation = "cookie"
+	ParamHeader ParamLocation = "header"
+)
+
+func ParseParamLocation(location string) (ParamLocation, error) {
+	switch ParamLocation(location) {
+	case "":
+		return ParamQuery, nil
+	case ParamQuery, ParamForm, ParamJSON, ParamCookie, ParamHeader:
+		return ParamLocation(location), nil
+	}
+
+	return "", fmt.Errorf("%w: param location %q", ErrUnsupported, location)
+}
+
+type ParamFinding struct {
+	Name     string        `bson:"name" json:"name"`
+	Value    string        `bson:"value" json:"value"`
+	Location ParamLocation `bson:"location" json:"location"`
+	Reason   string        `bson:"reason,omitempty" json:"reason,omitempty"`
+}
+
+type ScanJob struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	RequestID  primitive.ObjectID `bson:"request_id" json:"request_id"`
+	Location   ParamLocation      `bson:"location" json:"location"`
+	Status     ScanStatus         `bson:"status" json:"status"`
+	Findings   []ParamFinding     `bson:"findings" json:"findings"`
+	Tested     int                `bson:"tested" json:"tested"`
+	Requests   int                `bson:"requests" json:"requests"`
+	Error      string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	FinishedAt time.Time          `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
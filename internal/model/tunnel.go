@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+// TunnelMode tells how the proxy handled the stream inside a CONNECT tunnel.
+type TunnelMode string
+
+const (
+	TunnelTLS  TunnelMode = "tls"
+	TunnelHTTP TunnelMode = "http"
+	TunnelRaw  TunnelMode = "raw"
+	// TunnelPassthrough is a TLS tunnel relayed undecrypted because of a
+	// passthrough rule or repeated handshake failures.
+	TunnelPassthrough TunnelMode = "passthrough"
+)
+
+// TunnelStats is attached to a CONNECT request once its tunnel closes. Byte
+// counters are only kept for relayed tunnels, intercepted traffic is
+// recorded as separate requests instead.
+type TunnelStats struct {
+	Mode          TunnelMode `bson:"mode" json:"mode"`
+	BytesSent     int64      `bson:"bytes_sent" json:"bytes_sent"`
+	BytesReceived int64      `bson:"bytes_received" json:"bytes_received"`
+	ClosedAt      time.Time  `bson:"closed_at" json:"closed_at"`
+}
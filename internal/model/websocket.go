@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type WebSocketDirection string
+
+const (
+	WebSocketClientToServer WebSocketDirection = "client_to_server"
+	WebSocketServerToClient WebSocketDirection = "server_to_client"
+)
+
+const (
+	WebSocketOpText   = 0x1
+	WebSocketOpBinary = 0x2
+	WebSocketOpClose  = 0x8
+	WebSocketOpPing   = 0x9
+	WebSocketOpPong   = 0xA
+)
+
+// WebSocketMessage is a complete (reassembled) data message or a control
+// frame, linked to the upgrade handshake request. Payload keeps at most the
+// storage body limit; Size is the full message size.
+type WebSocketMessage struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	RequestID primitive.ObjectID `bson:"request_id" json:"request_id"`
+	Direction WebSocketDirection `bson:"direction" json:"direction"`
+	Opcode    int                `bson:"opcode" json:"opcode"`
+	Payload   []byte             `bson:"payload" json:"payload"`
+	Text      string             `bson:"text,omitempty" json:"text,omitempty"`
+	Size      int64              `bson:"size" json:"size"`
+	Truncated bool               `bson:"truncated,omitempty" json:"truncated,omitempty"`
+	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
+}
@@ -0,0 +1,109 @@
+// Package blob holds the content-addressed body storage shared by the
+// repositories: bodies are keyed by their SHA-256, so identical bodies are
+// stored once, and records keep only the key, size and a short preview.
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"simple_proxy/internal/model"
+	"unicode/utf8"
+)
+
+const previewSize = 512
+
+type Store interface {
+	Put(ctx context.Context, data []byte) (string, error)
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+func Key(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Preview cuts body to previewSize bytes without splitting a UTF-8
+// sequence.
+func Preview(body string) string {
+	if len(body) <= previewSize {
+		return body
+	}
+
+	end := previewSize
+	for end > 0 && !utf8.RuneStart(body[end]) {
+		end--
+	}
+	return body[:end]
+}
+
+// FileStore keeps each blob in its own file, fanned out by the first two
+// characters of the key.
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob directory %s: %w", dir, err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(key string) string {
+	return filepath.Join(s.dir, key[:2], key)
+}
+
+func (s *FileStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := Key(data)
+	path := s.path(key)
+
+	if _, err := os.Stat(path); err == nil {
+		return key, nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	// Written under a temporary name and renamed so a crash never leaves a
+	// partial blob under its final key.
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+
+	return key, nil
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if len(key) < 2 {
+		return nil, model.ErrNotFound
+	}
+
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, model.ErrNotFound
+	}
+
+	return data, err
+}
@@ -0,0 +1,111 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"simple_proxy/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stores := []struct {
+		name  string
+		store Store
+	}{
+		{name: "memory", store: NewMemoryStore()},
+		{name: "file", store: fileStore},
+	}
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			data := []byte{0x00, 0xff, 'b', 'o', 'd', 'y'}
+
+			key, err := tt.store.Put(ctx, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key != Key(data) || len(key) != 64 {
+				t.Errorf("Put returned key %q, want the SHA-256 %q", key, Key(data))
+			}
+
+			again, err := tt.store.Put(ctx, bytes.Clone(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again != key {
+				t.Errorf("identical body stored under %q and %q", key, again)
+			}
+
+			other, err := tt.store.Put(ctx, []byte("other body"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if other == key {
+				t.Error("different bodies share a key")
+			}
+
+			got, err := tt.store.Get(ctx, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("Get = %q, want %q", got, data)
+			}
+
+			for _, missing := range []string{Key([]byte("never stored")), "", "a"} {
+				_, err = tt.store.Get(ctx, missing)
+				if !errors.Is(err, model.ErrNotFound) {
+					t.Errorf("Get(%q) error = %v, want ErrNotFound", missing, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFileStoreDeduplicates(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for range 3 {
+		_, err := store.Put(context.Background(), []byte("same body"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var files []string
+	filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if len(files) != 1 || filepath.Base(files[0]) != Key([]byte("same body")) {
+		t.Errorf("store holds %v, want a single file named after the key", files)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	if got := Preview("short"); got != "short" {
+		t.Errorf("Preview(short) = %q", got)
+	}
+
+	// A multi-byte rune straddling the cut is dropped, not split.
+	body := strings.Repeat("a", previewSize-1) + "é" + "tail"
+	if got := Preview(body); got != strings.Repeat("a", previewSize-1) {
+		t.Errorf("Preview cut to %d bytes, want %d", len(got), previewSize-1)
+	}
+}
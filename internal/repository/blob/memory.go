@@ -0,0 +1,41 @@
+package blob
+
+import (
+	"context"
+	"simple_proxy/internal/model"
+	"sync"
+)
+
+type MemoryStore struct {
+	mutex sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		blobs: make(map[string][]byte),
+	}
+}
+
+func (s *MemoryStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := Key(data)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.blobs[key]; !ok {
+		s.blobs[key] = append([]byte(nil), data...)
+	}
+	return key, nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+	return data, nil
+}
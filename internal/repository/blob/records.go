@@ -0,0 +1,82 @@
+package blob
+
+import (
+	"context"
+	"simple_proxy/internal/model"
+	"unicode/utf8"
+)
+
+// StoreRequestBody moves the body of request into store, recording its key
+// and preview, and returns the copy to persist, which has no body.
+func StoreRequestBody(ctx context.Context, store Store, request *model.HTTPRequest) (model.HTTPRequest, error) {
+	if len(request.Body) > 0 {
+		key, err := store.Put(ctx, request.Body)
+		if err != nil {
+			return model.HTTPRequest{}, err
+		}
+		request.BodyHash = key
+		request.BodyPreview = textPreview(request.Body, request.Charset)
+	}
+
+	doc := *request
+	doc.Body = nil
+	doc.BodyText = ""
+	return doc, nil
+}
+
+// LoadRequestBody fills in the body of a request read back from storage.
+// Records saved before bodies moved to the blob store keep them inline.
+func LoadRequestBody(ctx context.Context, store Store, request *model.HTTPRequest) error {
+	if request.BodyHash == "" || len(request.Body) > 0 {
+		request.BodyText = model.TextView(request.Body, request.Charset)
+		return nil
+	}
+
+	data, err := store.Get(ctx, request.BodyHash)
+	if err != nil {
+		return err
+	}
+	request.Body = data
+	request.BodyText = model.TextView(data, request.Charset)
+	return nil
+}
+
+func StoreResponseBody(ctx context.Context, store Store, response *model.HTTPResponse) (model.HTTPResponse, error) {
+	if len(response.Body) > 0 {
+		key, err := store.Put(ctx, response.Body)
+		if err != nil {
+			return model.HTTPResponse{}, err
+		}
+		response.BodyHash = key
+		response.BodyPreview = textPreview(response.Body, response.Charset)
+	}
+
+	doc := *response
+	doc.Body = nil
+	doc.BodyText = ""
+	return doc, nil
+}
+
+func LoadResponseBody(ctx context.Context, store Store, response *model.HTTPResponse) error {
+	if response.BodyHash == "" || len(response.Body) > 0 {
+		response.BodyText = model.TextView(response.Body, response.Charset)
+		return nil
+	}
+
+	data, err := store.Get(ctx, response.BodyHash)
+	if err != nil {
+		return err
+	}
+	response.Body = data
+	response.BodyText = model.TextView(data, response.Charset)
+	return nil
+}
+
+// textPreview decodes only as much of body as the preview can show.
+// Binary bodies have no preview.
+func textPreview(body []byte, charset string) string {
+	if len(body) > previewSize*utf8.UTFMax {
+		body = body[:previewSize*utf8.UTFMax]
+	}
+	return Preview(model.TextView(body, charset))
+}
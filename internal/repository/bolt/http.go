@@ -0,0 +1,410 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"simple_proxy/internal/model"
+	"simple_proxy/internal/repository/blob"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	requestsBucket           = []byte("requests")
+	responsesBucket          = []byte("responses")
+	scansBucket              = []byte("scans")
+	requestsByTimeBucket     = []byte("requests_by_time")
+	requestsByHostBucket     = []byte("requests_by_host")
+	responsesByRequestBucket = []byte("responses_by_request")
+	messagesBucket           = []byte("websocket_messages")
+)
+
+// HTTPRepository keeps records in a single bbolt file and bodies as
+// content-addressed files in a directory next to it.
+type HTTPRepository struct {
+	db     *bbolt.DB
+	bodies *blob.FileStore
+}
+
+func NewHTTPRepository(path string) (*HTTPRepository, error) {
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{Timeout: 10 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{
+			requestsBucket,
+			responsesBucket,
+			scansBucket,
+			requestsByTimeBucket,
+			requestsByHostBucket,
+			responsesByRequestBucket,
+			messagesBucket,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	bodies, err := blob.NewFileStore(path + ".blobs")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &HTTPRepository{db: db, bodies: bodies}, nil
+}
+
+// timeKey orders index entries by timestamp, with the ID as a tie breaker.
+func timeKey(prefix []byte, timestamp time.Time, id primitive.ObjectID) []byte {
+	key := make([]byte, 0, len(prefix)+8+len(id))
+	key = append(key, prefix...)
+	key = binary.BigEndian.AppendUint64(key, uint64(timestamp.UnixNano()))
+	return append(key, id[:]...)
+}
+
+func hostPrefix(host string) []byte {
+	return append([]byte(host), 0)
+}
+
+func put(bucket *bbolt.Bucket, id primitive.ObjectID, v any) error {
+	data, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(id[:], data)
+}
+
+func get(bucket *bbolt.Bucket, id primitive.ObjectID, v any) error {
+	data := bucket.Get(id[:])
+	if data == nil {
+		return model.ErrNotFound
+	}
+
+	return bson.Unmarshal(data, v)
+}
+
+func (r *HTTPRepository) SaveRequest(ctx context.Context, request *model.HTTPRequest) error {
+	request.ID = primitive.NewObjectID()
+	request.Timestamp = time.Now()
+
+	doc, err := blob.StoreRequestBody(ctx, r.bodies, request)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		err := put(tx.Bucket(requestsBucket), doc.ID, &doc)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(requestsByTimeBucket).Put(timeKey(nil, request.Timestamp, request.ID), request.ID[:])
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(requestsByHostBucket).Put(timeKey(hostPrefix(request.TargetHost), request.Timestamp, request.ID), request.ID[:])
+	})
+}
+
+// UpdateRequestBody stores the body of a request saved before it was sent,
+// leaving the rest of the record as it is.
+func (r *HTTPRepository) UpdateRequestBody(ctx context.Context, request *model.HTTPRequest) error {
+	doc, err := blob.StoreRequestBody(ctx, r.bodies, request)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		requests := tx.Bucket(requestsBucket)
+
+		var stored model.HTTPRequest
+		err := get(requests, request.ID, &stored)
+		if err != nil {
+			return err
+		}
+
+		stored.Charset = doc.Charset
+		stored.BodyHash = doc.BodyHash
+		stored.BodyPreview = doc.BodyPreview
+		stored.BodySize = doc.BodySize
+		stored.BodyTruncated = doc.BodyTruncated
+		stored.FormParams = doc.FormParams
+		stored.Encodings = doc.Encodings
+		return put(requests, stored.ID, &stored)
+	})
+}
+
+func (r *HTTPRepository) SaveResponse(ctx context.Context, response *model.HTTPResponse) error {
+	response.ID = primitive.NewObjectID()
+	response.Timestamp = time.Now()
+
+	doc, err := blob.StoreResponseBody(ctx, r.bodies, response)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		err := put(tx.Bucket(responsesBucket), doc.ID, &doc)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Bucket(responsesByRequestBucket).Put(response.RequestID[:], response.ID[:])
+		if err != nil {
+			return err
+		}
+
+		requests := tx.Bucket(requestsBucket)
+
+		var request model.HTTPRequest
+		err = get(requests, response.RequestID, &request)
+		if errors.Is(err, model.ErrNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		request.ResponseID = response.ID
+		return put(requests, request.ID, &request)
+	})
+}
+
+func (r *HTTPRepository) GetTransaction(ctx context.Context, requestID primitive.ObjectID) (*model.HTTPTransaction, error) {
+	var transaction model.HTTPTransaction
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		err := get(tx.Bucket(requestsBucket), requestID, &transaction.Request)
+		if err != nil {
+			return err
+		}
+
+		responseID := tx.Bucket(responsesByRequestBucket).Get(requestID[:])
+		if responseID == nil {
+			return nil
+		}
+
+		var response model.HTTPResponse
+		err = get(tx.Bucket(responsesBucket), primitive.ObjectID(responseID), &response)
+		if err != nil {
+			return err
+		}
+
+		transaction.Response = &response
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = blob.LoadRequestBody(ctx, r.bodies, &transaction.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	if transaction.Response != nil {
+		err = blob.LoadResponseBody(ctx, r.bodies, transaction.Response)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &transaction, nil
+}
+
+func (r *HTTPRepository) GetRequest(ctx context.Context, id primitive.ObjectID) (*model.HTTPRequest, error) {
+	var request model.HTTPRequest
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(requestsBucket), id, &request)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = blob.LoadRequestBody(ctx, r.bodies, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (r *HTTPRepository) GetResponse(ctx context.Context, id primitive.ObjectID) (*model.HTTPResponse, error) {
+	var response model.HTTPResponse
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(responsesBucket), id, &response)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = blob.LoadResponseBody(ctx, r.bodies, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (r *HTTPRepository) ListRequests(ctx context.Context, filter model.RequestFilter, offset, limit int64) ([]model.HTTPRequest, int64, error) {
+	requests := make([]model.HTTPRequest, 0, limit)
+	var total int64
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		index := tx.Bucket(requestsByTimeBucket)
+		var prefix []byte
+		if filter.Host != "" {
+			index = tx.Bucket(requestsByHostBucket)
+			prefix = hostPrefix(filter.Host)
+		}
+
+		bucket := tx.Bucket(requestsBucket)
+		cursor := index.Cursor()
+
+		// Without a method filter every index key is a match, so only the
+		// requested page has to be decoded.
+		for k, v := lastWithPrefix(cursor, prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Prev() {
+			inPage := total >= offset && int64(len(requests)) < limit
+			if filter.Method == "" && !inPage {
+				total++
+				continue
+			}
+
+			var request model.HTTPRequest
+			err := get(bucket, primitive.ObjectID(v), &request)
+			if err != nil {
+				return err
+			}
+
+			if filter.Method != "" && request.Method != filter.Method {
+				continue
+			}
+
+			if inPage {
+				requests = append(requests, request)
+			}
+			total++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return requests, total, nil
+}
+
+// lastWithPrefix positions the cursor on the last key starting with prefix.
+func lastWithPrefix(cursor *bbolt.Cursor, prefix []byte) ([]byte, []byte) {
+	if len(prefix) == 0 {
+		return cursor.Last()
+	}
+
+	end := append(bytes.Clone(prefix[:len(prefix)-1]), prefix[len(prefix)-1]+1)
+	k, _ := cursor.Seek(end)
+	if k == nil {
+		return cursor.Last()
+	}
+
+	return cursor.Prev()
+}
+
+func (r *HTTPRepository) UpdateTunnelStats(ctx context.Context, requestID primitive.ObjectID, stats *model.TunnelStats) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		requests := tx.Bucket(requestsBucket)
+
+		var request model.HTTPRequest
+		err := get(requests, requestID, &request)
+		if err != nil {
+			return err
+		}
+
+		request.Tunnel = stats
+		return put(requests, request.ID, &request)
+	})
+}
+
+func (r *HTTPRepository) SaveScanJob(ctx context.Context, job *model.ScanJob) error {
+	job.ID = primitive.NewObjectID()
+	job.CreatedAt = time.Now()
+
+	return r.UpdateScanJob(ctx, job)
+}
+
+func (r *HTTPRepository) UpdateScanJob(ctx context.Context, job *model.ScanJob) error {
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		return put(tx.Bucket(scansBucket), job.ID, job)
+	})
+}
+
+func (r *HTTPRepository) GetScanJob(ctx context.Context, id primitive.ObjectID) (*model.ScanJob, error) {
+	var job model.ScanJob
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		return get(tx.Bucket(scansBucket), id, &job)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
+
+// Messages are keyed by handshake request ID and time, so a prefix scan
+// returns one connection's messages in order.
+func (r *HTTPRepository) SaveWebSocketMessage(ctx context.Context, message *model.WebSocketMessage) error {
+	message.ID = primitive.NewObjectID()
+
+	data, err := bson.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return r.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(messagesBucket).Put(timeKey(message.RequestID[:], message.Timestamp, message.ID), data)
+	})
+}
+
+func (r *HTTPRepository) ListWebSocketMessages(ctx context.Context, requestID primitive.ObjectID) ([]model.WebSocketMessage, error) {
+	messages := []model.WebSocketMessage{}
+
+	err := r.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(messagesBucket).Cursor()
+		prefix := requestID[:]
+
+		for k, v := cursor.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = cursor.Next() {
+			var message model.WebSocketMessage
+			err := bson.Unmarshal(v, &message)
+			if err != nil {
+				return err
+			}
+			messages = append(messages, message)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func (r *HTTPRepository) Close(ctx context.Context) error {
+	return r.db.Close()
+}
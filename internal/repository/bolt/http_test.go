@@ -0,0 +1,115 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"simple_proxy/internal/model"
+	"testing"
+)
+
+func newTestRepository(t *testing.T) *HTTPRepository {
+	t.Helper()
+
+	repo, err := NewHTTPRepository(filepath.Join(t.TempDir(), "proxy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { repo.Close(context.Background()) })
+	return repo
+}
+
+func seedRequests(t *testing.T, repo *HTTPRepository) []*model.HTTPRequest {
+	t.Helper()
+
+	var saved []*model.HTTPRequest
+	for i, spec := range []struct{ method, host string }{
+		{"GET", "a.example"},
+		{"POST", "a.example"},
+		{"GET", "b.example"},
+		{"GET", "a.example"},
+		{"PUT", "b.example"},
+		{"GET", "a.example.org"},
+	} {
+		request := &model.HTTPRequest{
+			Method:     spec.method,
+			TargetHost: spec.host,
+			Path:       fmt.Sprintf("/%d", i),
+			Body:       []byte(fmt.Sprintf("body %d", i)),
+		}
+		err := repo.SaveRequest(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, request)
+	}
+	return saved
+}
+
+func TestListRequests(t *testing.T) {
+	repo := newTestRepository(t)
+	seedRequests(t, repo)
+
+	tests := []struct {
+		name      string
+		filter    model.RequestFilter
+		offset    int64
+		limit     int64
+		wantPaths []string
+		wantTotal int64
+	}{
+		{name: "newest first", limit: 10, wantPaths: []string{"/5", "/4", "/3", "/2", "/1", "/0"}, wantTotal: 6},
+		{name: "first page", limit: 2, wantPaths: []string{"/5", "/4"}, wantTotal: 6},
+		{name: "second page", offset: 2, limit: 2, wantPaths: []string{"/3", "/2"}, wantTotal: 6},
+		{name: "last partial page", offset: 4, limit: 4, wantPaths: []string{"/1", "/0"}, wantTotal: 6},
+		{name: "past the end", offset: 10, limit: 2, wantPaths: []string{}, wantTotal: 6},
+		{name: "method filter", filter: model.RequestFilter{Method: "GET"}, limit: 10, wantPaths: []string{"/5", "/3", "/2", "/0"}, wantTotal: 4},
+		{name: "method filter second page", filter: model.RequestFilter{Method: "GET"}, offset: 2, limit: 1, wantPaths: []string{"/2"}, wantTotal: 4},
+		{name: "host filter", filter: model.RequestFilter{Host: "b.example"}, limit: 10, wantPaths: []string{"/4", "/2"}, wantTotal: 2},
+		{name: "host is not a prefix match", filter: model.RequestFilter{Host: "a.example"}, limit: 10, wantPaths: []string{"/3", "/1", "/0"}, wantTotal: 3},
+		{name: "longer host name", filter: model.RequestFilter{Host: "a.example.org"}, limit: 10, wantPaths: []string{"/5"}, wantTotal: 1},
+		{name: "unknown host", filter: model.RequestFilter{Host: "c.example"}, limit: 10, wantPaths: []string{}, wantTotal: 0},
+		{name: "both filters", filter: model.RequestFilter{Method: "GET", Host: "a.example"}, offset: 1, limit: 1, wantPaths: []string{"/0"}, wantTotal: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests, total, err := repo.ListRequests(context.Background(), tt.filter, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			paths := make([]string, 0, len(requests))
+			for _, request := range requests {
+				paths = append(paths, request.Path)
+			}
+
+			if total != tt.wantTotal || fmt.Sprint(paths) != fmt.Sprint(tt.wantPaths) {
+				t.Errorf("got %v (total %d), want %v (total %d)", paths, total, tt.wantPaths, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestListRequestsOmitsBodies(t *testing.T) {
+	repo := newTestRepository(t)
+	saved := seedRequests(t, repo)
+
+	requests, _, err := repo.ListRequests(context.Background(), model.RequestFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, request := range requests {
+		if len(request.Body) != 0 || request.BodyHash == "" {
+			t.Errorf("listed %s with %d body bytes and hash %q, want only the hash", request.Path, len(request.Body), request.BodyHash)
+		}
+	}
+
+	request, err := repo.GetRequest(context.Background(), saved[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(request.Body) != "body 1" {
+		t.Errorf("GetRequest body = %q, want %q", request.Body, "body 1")
+	}
+}
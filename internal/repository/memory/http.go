@@ -0,0 +1,248 @@
+package memory
+
+import (
+	"context"
+	"simple_proxy/internal/model"
+	"simple_proxy/internal/repository/blob"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type HTTPRepository struct {
+	mutex     sync.RWMutex
+	requests  map[primitive.ObjectID]model.HTTPRequest
+	responses map[primitive.ObjectID]model.HTTPResponse
+	scans     map[primitive.ObjectID]model.ScanJob
+	messages  map[primitive.ObjectID][]model.WebSocketMessage
+	order     []primitive.ObjectID
+	bodies    *blob.MemoryStore
+}
+
+func NewHTTPRepository() *HTTPRepository {
+	return &HTTPRepository{
+		requests:  make(map[primitive.ObjectID]model.HTTPRequest),
+		responses: make(map[primitive.ObjectID]model.HTTPResponse),
+		scans:     make(map[primitive.ObjectID]model.ScanJob),
+		messages:  make(map[primitive.ObjectID][]model.WebSocketMessage),
+		bodies:    blob.NewMemoryStore(),
+	}
+}
+
+func (r *HTTPRepository) SaveRequest(ctx context.Context, request *model.HTTPRequest) error {
+	request.ID = primitive.NewObjectID()
+	request.Timestamp = time.Now()
+
+	doc, err := blob.StoreRequestBody(ctx, r.bodies, request)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.requests[request.ID] = doc
+	r.order = append(r.order, request.ID)
+	return nil
+}
+
+// UpdateRequestBody stores the body of a request saved before it was sent,
+// leaving the rest of the record as it is.
+func (r *HTTPRepository) UpdateRequestBody(ctx context.Context, request *model.HTTPRequest) error {
+	doc, err := blob.StoreRequestBody(ctx, r.bodies, request)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	stored, ok := r.requests[request.ID]
+	if !ok {
+		return model.ErrNotFound
+	}
+
+	stored.Charset = doc.Charset
+	stored.BodyHash = doc.BodyHash
+	stored.BodyPreview = doc.BodyPreview
+	stored.BodySize = doc.BodySize
+	stored.BodyTruncated = doc.BodyTruncated
+	stored.FormParams = doc.FormParams
+	stored.Encodings = doc.Encodings
+	r.requests[request.ID] = stored
+	return nil
+}
+
+func (r *HTTPRepository) SaveResponse(ctx context.Context, response *model.HTTPResponse) error {
+	response.ID = primitive.NewObjectID()
+	response.Timestamp = time.Now()
+
+	doc, err := blob.StoreResponseBody(ctx, r.bodies, response)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.responses[response.ID] = doc
+
+	if request, ok := r.requests[response.RequestID]; ok {
+		request.ResponseID = response.ID
+		r.requests[response.RequestID] = request
+	}
+	return nil
+}
+
+func (r *HTTPRepository) GetTransaction(ctx context.Context, requestID primitive.ObjectID) (*model.HTTPTransaction, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	request, ok := r.requests[requestID]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	transaction := &model.HTTPTransaction{Request: request}
+	err := blob.LoadRequestBody(ctx, r.bodies, &transaction.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response, ok := r.responses[request.ResponseID]; ok {
+		err = blob.LoadResponseBody(ctx, r.bodies, &response)
+		if err != nil {
+			return nil, err
+		}
+		transaction.Response = &response
+	}
+
+	return transaction, nil
+}
+
+func (r *HTTPRepository) GetRequest(ctx context.Context, id primitive.ObjectID) (*model.HTTPRequest, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	request, ok := r.requests[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	err := blob.LoadRequestBody(ctx, r.bodies, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (r *HTTPRepository) GetResponse(ctx context.Context, id primitive.ObjectID) (*model.HTTPResponse, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	response, ok := r.responses[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	err := blob.LoadResponseBody(ctx, r.bodies, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (r *HTTPRepository) ListRequests(ctx context.Context, filter model.RequestFilter, offset, limit int64) ([]model.HTTPRequest, int64, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var matched []model.HTTPRequest
+	for i := len(r.order) - 1; i >= 0; i-- {
+		request := r.requests[r.order[i]]
+		if filter.Method != "" && request.Method != filter.Method {
+			continue
+		}
+		if filter.Host != "" && request.TargetHost != filter.Host {
+			continue
+		}
+		matched = append(matched, request)
+	}
+
+	total := int64(len(matched))
+	if offset >= total {
+		return []model.HTTPRequest{}, total, nil
+	}
+
+	end := min(offset+limit, total)
+	return matched[offset:end], total, nil
+}
+
+func (r *HTTPRepository) UpdateTunnelStats(ctx context.Context, requestID primitive.ObjectID, stats *model.TunnelStats) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	request, ok := r.requests[requestID]
+	if !ok {
+		return model.ErrNotFound
+	}
+
+	statsCopy := *stats
+	request.Tunnel = &statsCopy
+	r.requests[requestID] = request
+	return nil
+}
+
+func (r *HTTPRepository) SaveScanJob(ctx context.Context, job *model.ScanJob) error {
+	job.ID = primitive.NewObjectID()
+	job.CreatedAt = time.Now()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.scans[job.ID] = *job
+	return nil
+}
+
+func (r *HTTPRepository) UpdateScanJob(ctx context.Context, job *model.ScanJob) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.scans[job.ID] = *job
+	return nil
+}
+
+func (r *HTTPRepository) GetScanJob(ctx context.Context, id primitive.ObjectID) (*model.ScanJob, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	job, ok := r.scans[id]
+	if !ok {
+		return nil, model.ErrNotFound
+	}
+
+	return &job, nil
+}
+
+func (r *HTTPRepository) SaveWebSocketMessage(ctx context.Context, message *model.WebSocketMessage) error {
+	message.ID = primitive.NewObjectID()
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.messages[message.RequestID] = append(r.messages[message.RequestID], *message)
+	return nil
+}
+
+func (r *HTTPRepository) ListWebSocketMessages(ctx context.Context, requestID primitive.ObjectID) ([]model.WebSocketMessage, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return append([]model.WebSocketMessage{}, r.messages[requestID]...), nil
+}
+
+func (r *HTTPRepository) Close(ctx context.Context) error {
+	return nil
+}
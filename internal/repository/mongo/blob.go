@@ -0,0 +1,93 @@
+package mongo
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"simple_proxy/internal/model"
+	"simple_proxy/internal/repository/blob"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const bodiesBucket = "bodies"
+
+// gridFSStore keeps bodies in GridFS with the SHA-256 key as file ID, so
+// documents stay far below the 16MB limit and repeated bodies are stored
+// once.
+//
+// The bucket is shared by all operations. Its UploadFromStream helpers
+// reuse one buffer, so uploads go through streams of their own, and
+// opening one is serialized because the bucket checks its indexes on the
+// first write without synchronization.
+type gridFSStore struct {
+	bucket    *gridfs.Bucket
+	openMutex sync.Mutex
+}
+
+func newGridFSStore(database *mongo.Database) (*gridFSStore, error) {
+	bucket, err := gridfs.NewBucket(database, options.GridFSBucket().SetName(bodiesBucket))
+	if err != nil {
+		return nil, err
+	}
+
+	return &gridFSStore{bucket: bucket}, nil
+}
+
+func (s *gridFSStore) Put(ctx context.Context, data []byte) (string, error) {
+	key := blob.Key(data)
+
+	count, err := s.bucket.GetFilesCollection().CountDocuments(ctx, bson.M{"_id": key}, options.Count().SetLimit(1))
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return key, nil
+	}
+
+	s.openMutex.Lock()
+	upload, err := s.bucket.OpenUploadStreamWithID(key, key)
+	s.openMutex.Unlock()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = upload.Write(data)
+	if err != nil {
+		upload.Abort()
+		return "", err
+	}
+
+	err = upload.Close()
+	if mongo.IsDuplicateKeyError(err) {
+		return key, nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return key, nil
+}
+
+func (s *gridFSStore) Get(ctx context.Context, key string) ([]byte, error) {
+	download, err := s.bucket.OpenDownloadStream(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, model.ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer download.Close()
+
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(download)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -2,8 +2,10 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"log"
 	"simple_proxy/internal/model"
+	"simple_proxy/internal/repository/blob"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -17,6 +19,9 @@ type HTTPRepository struct {
 	database      string
 	requestsColl  *mongo.Collection
 	responsesColl *mongo.Collection
+	scansColl     *mongo.Collection
+	messagesColl  *mongo.Collection
+	bodies        blob.Store
 }
 
 func NewHTTPRepository(uri, database string) (*HTTPRepository, error) {
@@ -33,11 +38,19 @@ func NewHTTPRepository(uri, database string) (*HTTPRepository, error) {
 		return nil, err
 	}
 
+	bodies, err := newGridFSStore(client.Database(database))
+	if err != nil {
+		return nil, err
+	}
+
 	repo := &HTTPRepository{
 		client:        client,
 		database:      database,
 		requestsColl:  client.Database(database).Collection("requests"),
 		responsesColl: client.Database(database).Collection("responses"),
+		scansColl:     client.Database(database).Collection("scans"),
+		messagesColl:  client.Database(database).Collection("websocket_messages"),
+		bodies:        bodies,
 	}
 
 	repo.createIndexes(ctx)
@@ -59,13 +72,56 @@ func (r *HTTPRepository) createIndexes(ctx context.Context) {
 	if err != nil {
 		log.Printf("Error creating request_id index on responses: %v", err)
 	}
+
+	_, err = r.scansColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "request_id", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating request_id index on scans: %v", err)
+	}
+
+	_, err = r.messagesColl.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "request_id", Value: 1}, {Key: "timestamp", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating request_id index on websocket_messages: %v", err)
+	}
 }
 
 func (r *HTTPRepository) SaveRequest(ctx context.Context, request *model.HTTPRequest) error {
 	request.ID = primitive.NewObjectID()
 	request.Timestamp = time.Now()
 
-	_, err := r.requestsColl.InsertOne(ctx, request)
+	doc, err := blob.StoreRequestBody(ctx, r.bodies, request)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.requestsColl.InsertOne(ctx, doc)
+	return err
+}
+
+// UpdateRequestBody stores the body of a request saved before it was sent,
+// leaving the rest of the record as it is.
+func (r *HTTPRepository) UpdateRequestBody(ctx context.Context, request *model.HTTPRequest) error {
+	doc, err := blob.StoreRequestBody(ctx, r.bodies, request)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.requestsColl.UpdateOne(
+		ctx,
+		bson.M{"_id": request.ID},
+		bson.M{"$set": bson.M{
+			"charset":        doc.Charset,
+			"body_hash":      doc.BodyHash,
+			"body_preview":   doc.BodyPreview,
+			"body_size":      doc.BodySize,
+			"body_truncated": doc.BodyTruncated,
+			"form_params":    doc.FormParams,
+			"encodings":      doc.Encodings,
+		}},
+	)
 	return err
 }
 
@@ -73,7 +129,12 @@ func (r *HTTPRepository) SaveResponse(ctx context.Context, response *model.HTTPR
 	response.ID = primitive.NewObjectID()
 	response.Timestamp = time.Now()
 
-	_, err := r.responsesColl.InsertOne(ctx, response)
+	doc, err := blob.StoreResponseBody(ctx, r.bodies, response)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.responsesColl.InsertOne(ctx, doc)
 	if err != nil {
 		return err
 	}
@@ -87,24 +148,157 @@ func (r *HTTPRepository) SaveResponse(ctx context.Context, response *model.HTTPR
 }
 
 func (r *HTTPRepository) GetTransaction(ctx context.Context, requestID primitive.ObjectID) (*model.HTTPTransaction, error) {
-	var request model.HTTPRequest
-	err := r.requestsColl.FindOne(ctx, bson.M{"_id": requestID}).Decode(&request)
+	request, err := r.GetRequest(ctx, requestID)
 	if err != nil {
 		return nil, err
 	}
 
 	var response model.HTTPResponse
 	err = r.responsesColl.FindOne(ctx, bson.M{"request_id": requestID}).Decode(&response)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return &model.HTTPTransaction{Request: *request}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = blob.LoadResponseBody(ctx, r.bodies, &response)
 	if err != nil {
 		return nil, err
 	}
 
 	return &model.HTTPTransaction{
-		Request:  request,
-		Response: response,
+		Request:  *request,
+		Response: &response,
 	}, nil
 }
 
+func (r *HTTPRepository) GetRequest(ctx context.Context, id primitive.ObjectID) (*model.HTTPRequest, error) {
+	var request model.HTTPRequest
+	err := r.requestsColl.FindOne(ctx, bson.M{"_id": id}).Decode(&request)
+	if err != nil {
+		return nil, wrapNotFound(err)
+	}
+
+	err = blob.LoadRequestBody(ctx, r.bodies, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+func (r *HTTPRepository) GetResponse(ctx context.Context, id primitive.ObjectID) (*model.HTTPResponse, error) {
+	var response model.HTTPResponse
+	err := r.responsesColl.FindOne(ctx, bson.M{"_id": id}).Decode(&response)
+	if err != nil {
+		return nil, wrapNotFound(err)
+	}
+
+	err = blob.LoadResponseBody(ctx, r.bodies, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response, nil
+}
+
+func (r *HTTPRepository) ListRequests(ctx context.Context, filter model.RequestFilter, offset, limit int64) ([]model.HTTPRequest, int64, error) {
+	query := bson.M{}
+	if filter.Method != "" {
+		query["method"] = filter.Method
+	}
+	if filter.Host != "" {
+		query["target_host"] = filter.Host
+	}
+
+	total, err := r.requestsColl.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip(offset).
+		SetLimit(limit)
+
+	cursor, err := r.requestsColl.Find(ctx, query, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	requests := make([]model.HTTPRequest, 0, limit)
+	err = cursor.All(ctx, &requests)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return requests, total, nil
+}
+
+func (r *HTTPRepository) UpdateTunnelStats(ctx context.Context, requestID primitive.ObjectID, stats *model.TunnelStats) error {
+	_, err := r.requestsColl.UpdateOne(
+		ctx,
+		bson.M{"_id": requestID},
+		bson.M{"$set": bson.M{"tunnel": stats}},
+	)
+	return err
+}
+
+func (r *HTTPRepository) SaveScanJob(ctx context.Context, job *model.ScanJob) error {
+	job.ID = primitive.NewObjectID()
+	job.CreatedAt = time.Now()
+
+	_, err := r.scansColl.InsertOne(ctx, job)
+	return err
+}
+
+func (r *HTTPRepository) UpdateScanJob(ctx context.Context, job *model.ScanJob) error {
+	_, err := r.scansColl.ReplaceOne(ctx, bson.M{"_id": job.ID}, job)
+	return err
+}
+
+func (r *HTTPRepository) GetScanJob(ctx context.Context, id primitive.ObjectID) (*model.ScanJob, error) {
+	var job model.ScanJob
+	err := r.scansColl.FindOne(ctx, bson.M{"_id": id}).Decode(&job)
+	if err != nil {
+		return nil, wrapNotFound(err)
+	}
+
+	return &job, nil
+}
+
+func (r *HTTPRepository) SaveWebSocketMessage(ctx context.Context, message *model.WebSocketMessage) error {
+	message.ID = primitive.NewObjectID()
+
+	_, err := r.messagesColl.InsertOne(ctx, message)
+	return err
+}
+
+func (r *HTTPRepository) ListWebSocketMessages(ctx context.Context, requestID primitive.ObjectID) ([]model.WebSocketMessage, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}})
+
+	cursor, err := r.messagesColl.Find(ctx, bson.M{"request_id": requestID}, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []model.WebSocketMessage{}
+	err = cursor.All(ctx, &messages)
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+func wrapNotFound(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return model.ErrNotFound
+	}
+	return err
+}
+
 func (r *HTTPRepository) Close(ctx context.Context) error {
 	return r.client.Disconnect(ctx)
 }
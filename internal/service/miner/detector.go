@@ -0,0 +1,126 @@
+package miner
+
+import (
+	"fmt"
+	"net/http"
+	"simple_proxy/internal/model"
+	"strings"
+)
+
+type Thresholds struct {
+	Baselines   int // number of baseline requests used to learn dynamic content
+	LengthDelta int // body length change in bytes tolerated beyond the baseline range
+	WordDelta   int // word count change tolerated beyond the baseline range
+}
+
+type responseProfile struct {
+	StatusCode int
+	Length     int
+	Words      int
+	Headers    map[string]struct{}
+	Body       string
+}
+
+func newResponseProfile(statusCode int, header http.Header, body string) *responseProfile {
+	headers := make(map[string]struct{}, len(header))
+	for key := range header {
+		headers[http.CanonicalHeaderKey(key)] = struct{}{}
+	}
+
+	return &responseProfile{
+		StatusCode: statusCode,
+		Length:     len(body),
+		Words:      len(strings.Fields(body)),
+		Headers:    headers,
+		Body:       body,
+	}
+}
+
+// detector compares probe responses against a set of baselines. Anything
+// that already varies between baselines is treated as dynamic noise.
+type detector struct {
+	thresholds   Thresholds
+	statusCode   int
+	stableStatus bool
+	minLength    int
+	maxLength    int
+	minWords     int
+	maxWords     int
+	allHeaders   map[string]struct{}
+	anyHeaders   map[string]struct{}
+}
+
+func newDetector(baselines []*responseProfile, thresholds Thresholds) *detector {
+	d := &detector{
+		thresholds:   thresholds,
+		statusCode:   baselines[0].StatusCode,
+		stableStatus: true,
+		minLength:    baselines[0].Length,
+		maxLength:    baselines[0].Length,
+		minWords:     baselines[0].Words,
+		maxWords:     baselines[0].Words,
+		allHeaders:   make(map[string]struct{}),
+		anyHeaders:   make(map[string]struct{}),
+	}
+
+	for key := range baselines[0].Headers {
+		d.allHeaders[key] = struct{}{}
+	}
+
+	for _, baseline := range baselines {
+		if baseline.StatusCode != d.statusCode {
+			d.stableStatus = false
+		}
+
+		d.minLength = min(d.minLength, baseline.Length)
+		d.maxLength = max(d.maxLength, baseline.Length)
+		d.minWords = min(d.minWords, baseline.Words)
+		d.maxWords = max(d.maxWords, baseline.Words)
+
+		for key := range baseline.Headers {
+			d.anyHeaders[key] = struct{}{}
+		}
+		for key := range d.allHeaders {
+			if _, ok := baseline.Headers[key]; !ok {
+				delete(d.allHeaders, key)
+			}
+		}
+	}
+
+	return d
+}
+
+// changed reports why the response to a batch differs from the baselines,
+// or an empty string when it does not.
+func (d *detector) changed(resp *responseProfile, batch []model.ParamFinding) string {
+	for _, candidate := range batch {
+		if strings.Contains(resp.Body, candidate.Value) {
+			return "value reflected"
+		}
+	}
+
+	if d.stableStatus && resp.StatusCode != d.statusCode {
+		return fmt.Sprintf("status code %d -> %d", d.statusCode, resp.StatusCode)
+	}
+
+	for key := range resp.Headers {
+		if _, ok := d.anyHeaders[key]; !ok {
+			return fmt.Sprintf("new header %s", key)
+		}
+	}
+	for key := range d.allHeaders {
+		if _, ok := resp.Headers[key]; !ok {
+			return fmt.Sprintf("missing header %s", key)
+		}
+	}
+
+	if resp.Length < d.minLength-d.thresholds.LengthDelta || resp.Length > d.maxLength+d.thresholds.LengthDelta {
+		return fmt.Sprintf("body length %d outside %d-%d", resp.Length, d.minLength, d.maxLength)
+	}
+
+	if resp.Words < d.minWords-d.thresholds.WordDelta || resp.Words > d.maxWords+d.thresholds.WordDelta {
+		return fmt.Sprintf("word count %d outside %d-%d", resp.Words, d.minWords, d.maxWords)
+	}
+
+	return ""
+}
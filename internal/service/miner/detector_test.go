@@ -0,0 +1,60 @@
+package miner
+
+import (
+	"net/http"
+	"simple_proxy/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestDetectorChanged(t *testing.T) {
+	header := http.Header{"Content-Type": {"text/html"}, "Date": {"now"}}
+	baselines := []*responseProfile{
+		newResponseProfile(200, header, "<p>welcome back token=1a2b3c</p>"),
+		newResponseProfile(200, header, "<p>welcome back token=9f8e7d6c5b</p>"),
+		newResponseProfile(200, http.Header{"Content-Type": {"text/html"}, "Date": {"now"}, "X-Cache": {"hit"}}, "<p>welcome back token=00</p>"),
+	}
+	d := newDetector(baselines, Thresholds{LengthDelta: 4, WordDelta: 1})
+	batch := []model.ParamFinding{{Name: "debug", Value: "c0ffee"}}
+
+	tests := []struct {
+		name    string
+		status  int
+		header  http.Header
+		body    string
+		changed bool
+	}{
+		{name: "same as a baseline", status: 200, header: header, body: "<p>welcome back token=1a2b3c</p>"},
+		{name: "dynamic token within the baseline range", status: 200, header: header, body: "<p>welcome back token=5555</p>"},
+		{name: "length within the delta", status: 200, header: header, body: "<p>welcome back token=9f8e7d6c5b4a</p>"},
+		{name: "header seen in one baseline", status: 200, header: http.Header{"Content-Type": {"text/html"}, "Date": {"now"}, "X-Cache": {"miss"}}, body: "<p>welcome back token=00</p>"},
+		{name: "status code", status: 500, header: header, body: "<p>welcome back token=1a2b3c</p>", changed: true},
+		{name: "reflected value", status: 200, header: header, body: "<p>welcome back c0ffee</p>", changed: true},
+		{name: "longer body", status: 200, header: header, body: "<p>welcome back token=1a2b3c</p><p>debug output follows</p>", changed: true},
+		{name: "more words", status: 200, header: header, body: "<p>welcome back a b token=1</p>", changed: true},
+		{name: "new header", status: 200, header: http.Header{"Content-Type": {"text/html"}, "Date": {"now"}, "X-Debug": {"1"}}, body: "<p>welcome back token=1a2b3c</p>", changed: true},
+		{name: "missing header", status: 200, header: http.Header{"Date": {"now"}}, body: "<p>welcome back token=1a2b3c</p>", changed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := d.changed(newResponseProfile(tt.status, tt.header, tt.body), batch)
+			if (reason != "") != tt.changed {
+				t.Errorf("changed() = %q, want changed %v", reason, tt.changed)
+			}
+		})
+	}
+}
+
+func TestDetectorUnstableStatus(t *testing.T) {
+	baselines := []*responseProfile{
+		newResponseProfile(200, nil, "ok"),
+		newResponseProfile(429, nil, "ok"),
+	}
+	d := newDetector(baselines, Thresholds{})
+
+	reason := d.changed(newResponseProfile(503, nil, "ok"), nil)
+	if strings.HasPrefix(reason, "status code") {
+		t.Errorf("status code reported although it already varied between baselines: %q", reason)
+	}
+}
@@ -0,0 +1,152 @@
+package miner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"simple_proxy/internal/model"
+	"strings"
+)
+
+const (
+	maxInjectedLength = 4096
+	maxHeaderBatch    = 64
+)
+
+// inject returns a copy of the request carrying the batch at the given
+// location. The original body, query string, cookies and headers are kept.
+func inject(request *model.HTTPRequest, location model.ParamLocation, batch []model.ParamFinding) (*model.HTTPRequest, error) {
+	candidate := *request
+	candidate.QueryParams = copyValues(request.QueryParams)
+	candidate.Headers = copyValues(request.Headers)
+	candidate.Cookies = make(map[string]string, len(request.Cookies))
+	for name, value := range request.Cookies {
+		candidate.Cookies[name] = value
+	}
+
+	switch location {
+	case model.ParamQuery:
+		added := url.Values{}
+		for _, param := range batch {
+			candidate.QueryParams[param.Name] = []string{param.Value}
+			added.Set(param.Name, param.Value)
+		}
+		// The original query is replayed as it was sent, candidates go after it.
+		if request.RawQuery != "" && len(added) > 0 {
+			candidate.RawQuery = request.RawQuery + "&" + added.Encode()
+		}
+	case model.ParamForm:
+		form, err := url.ParseQuery(string(request.Body))
+		if err != nil {
+			return nil, fmt.Errorf("%w: body is not form-urlencoded: %v", model.ErrUnsupported, err)
+		}
+		for _, param := range batch {
+			form.Set(param.Name, param.Value)
+		}
+		candidate.Body = []byte(form.Encode())
+		setDefaultContentType(candidate.Headers, "application/x-www-form-urlencoded")
+	case model.ParamJSON:
+		object := make(map[string]any)
+		if len(bytes.TrimSpace(request.Body)) > 0 {
+			decoder := json.NewDecoder(bytes.NewReader(request.Body))
+			decoder.UseNumber()
+			if err := decoder.Decode(&object); err != nil {
+				return nil, fmt.Errorf("%w: body is not a JSON object: %v", model.ErrUnsupported, err)
+			}
+		}
+		for _, param := range batch {
+			object[param.Name] = param.Value
+		}
+		var body bytes.Buffer
+		encoder := json.NewEncoder(&body)
+		encoder.SetEscapeHTML(false)
+		if err := encoder.Encode(object); err != nil {
+			return nil, err
+		}
+		candidate.Body = bytes.TrimSuffix(body.Bytes(), []byte("\n"))
+		setDefaultContentType(candidate.Headers, "application/json")
+	case model.ParamCookie:
+		if cookie, ok := candidate.Headers["Cookie"]; ok && len(cookie) > 0 {
+			pairs := []string{strings.Join(cookie, "; ")}
+			for _, param := range batch {
+				pairs = append(pairs, param.Name+"="+param.Value)
+			}
+			candidate.Headers["Cookie"] = []string{strings.Join(pairs, "; ")}
+		} else {
+			for _, param := range batch {
+				candidate.Cookies[param.Name] = param.Value
+			}
+		}
+	case model.ParamHeader:
+		for _, param := range batch {
+			candidate.Headers[http.CanonicalHeaderKey(param.Name)] = []string{param.Value}
+		}
+	default:
+		return nil, fmt.Errorf("%w: param location %q", model.ErrUnsupported, location)
+	}
+
+	return &candidate, nil
+}
+
+// acceptsCandidate skips names that already exist at the location or that
+// cannot be sent there.
+func acceptsCandidate(request *model.HTTPRequest, location model.ParamLocation, name string) bool {
+	switch location {
+	case model.ParamQuery:
+		_, ok := request.QueryParams[name]
+		return !ok
+	case model.ParamForm, model.ParamJSON:
+		return !bytes.Contains(request.Body, []byte(`"`+name+`"`)) && !bytes.Contains(request.Body, []byte(name+"="))
+	case model.ParamCookie:
+		_, ok := request.Cookies[name]
+		return !ok && isToken(name)
+	case model.ParamHeader:
+		_, ok := request.Headers[http.CanonicalHeaderKey(name)]
+		return !ok && isToken(name)
+	}
+
+	return false
+}
+
+func candidateSize(location model.ParamLocation, candidate model.ParamFinding) int {
+	switch location {
+	case model.ParamQuery, model.ParamForm:
+		return len(url.QueryEscape(candidate.Name)) + len(candidate.Value) + 2
+	case model.ParamJSON:
+		return len(candidate.Name) + len(candidate.Value) + 6
+	default:
+		return len(candidate.Name) + len(candidate.Value) + 4
+	}
+}
+
+func isToken(name string) bool {
+	if name == "" {
+		return false
+	}
+
+	for _, c := range name {
+		isAlnum := c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+		if !isAlnum && c != '-' && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func setDefaultContentType(headers map[string][]string, contentType string) {
+	if len(headers["Content-Type"]) == 0 {
+		headers["Content-Type"] = []string{contentType}
+	}
+}
+
+func copyValues(values map[string][]string) map[string][]string {
+	copied := make(map[string][]string, len(values))
+	for key, value := range values {
+		copied[key] = value
+	}
+
+	return copied
+}
@@ -0,0 +1,221 @@
+package miner
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"simple_proxy/internal/model"
+	"testing"
+)
+
+var testBatch = []model.ParamFinding{
+	{Name: "debug", Value: "c0ffee"},
+	{Name: "x-role", Value: "admin"},
+}
+
+func TestInjectQuery(t *testing.T) {
+	request := &model.HTTPRequest{QueryParams: map[string][]string{"id": {"1"}}}
+
+	candidate, err := inject(request, model.ParamQuery, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"id": {"1"}, "debug": {"c0ffee"}, "x-role": {"admin"}}
+	if !reflect.DeepEqual(candidate.QueryParams, want) {
+		t.Errorf("query = %v, want %v", candidate.QueryParams, want)
+	}
+	if len(request.QueryParams) != 1 {
+		t.Errorf("original query changed to %v", request.QueryParams)
+	}
+
+	// A raw query is replayed as received, with the candidates appended.
+	request.RawQuery = "id=1&sort=z;a&q=%7e"
+	candidate, err = inject(request, model.ParamQuery, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id=1&sort=z;a&q=%7e&debug=c0ffee&x-role=admin"; candidate.RawQuery != want {
+		t.Errorf("raw query = %q, want %q", candidate.RawQuery, want)
+	}
+	if request.RawQuery != "id=1&sort=z;a&q=%7e" {
+		t.Errorf("original raw query changed to %q", request.RawQuery)
+	}
+}
+
+func TestInjectForm(t *testing.T) {
+	request := &model.HTTPRequest{
+		Headers: map[string][]string{"Content-Type": {"application/x-www-form-urlencoded; charset=utf-8"}},
+		Body:    []byte("user=bob&note=a+b%26c"),
+	}
+
+	candidate, err := inject(request, model.ParamForm, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	form, err := url.ParseQuery(string(candidate.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{"user": {"bob"}, "note": {"a b&c"}, "debug": {"c0ffee"}, "x-role": {"admin"}}
+	if !reflect.DeepEqual(form, want) {
+		t.Errorf("form = %v, want %v", form, want)
+	}
+	if got := candidate.Headers["Content-Type"]; !reflect.DeepEqual(got, request.Headers["Content-Type"]) {
+		t.Errorf("Content-Type = %q, want it preserved", got)
+	}
+	if string(request.Body) != "user=bob&note=a+b%26c" {
+		t.Errorf("original body changed to %q", request.Body)
+	}
+
+	candidate, err = inject(&model.HTTPRequest{}, model.ParamForm, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := candidate.Headers["Content-Type"]; !reflect.DeepEqual(got, []string{"application/x-www-form-urlencoded"}) {
+		t.Errorf("Content-Type of an empty form = %q", got)
+	}
+
+	_, err = inject(&model.HTTPRequest{Body: []byte("%zz")}, model.ParamForm, testBatch)
+	if !errors.Is(err, model.ErrUnsupported) {
+		t.Errorf("injecting into an invalid form returned %v, want ErrUnsupported", err)
+	}
+}
+
+func TestInjectJSON(t *testing.T) {
+	request := &model.HTTPRequest{
+		Headers: map[string][]string{"Content-Type": {"application/vnd.api+json"}},
+		Body:    []byte(`{"id": 12345678901234567890, "html": "<b>", "nested": {"a": [1, 2]}}`),
+	}
+
+	candidate, err := inject(request, model.ParamJSON, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var object map[string]json.RawMessage
+	err = json.Unmarshal(candidate.Body, &object)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"id":     `12345678901234567890`,
+		"html":   `"<b>"`,
+		"nested": `{"a":[1,2]}`,
+		"debug":  `"c0ffee"`,
+		"x-role": `"admin"`,
+	}
+	for key, value := range want {
+		if string(object[key]) != value {
+			t.Errorf("%s = %s, want %s", key, object[key], value)
+		}
+	}
+	if len(object) != len(want) {
+		t.Errorf("body = %s, want %d keys", candidate.Body, len(want))
+	}
+	if got := candidate.Headers["Content-Type"]; !reflect.DeepEqual(got, []string{"application/vnd.api+json"}) {
+		t.Errorf("Content-Type = %q, want it preserved", got)
+	}
+
+	candidate, err = inject(&model.HTTPRequest{}, model.ParamJSON, testBatch[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(candidate.Body) != `{"debug":"c0ffee"}` || candidate.Headers["Content-Type"][0] != "application/json" {
+		t.Errorf("empty body became %s with Content-Type %q", candidate.Body, candidate.Headers["Content-Type"])
+	}
+
+	_, err = inject(&model.HTTPRequest{Body: []byte(`[1, 2]`)}, model.ParamJSON, testBatch)
+	if !errors.Is(err, model.ErrUnsupported) {
+		t.Errorf("injecting into a JSON array returned %v, want ErrUnsupported", err)
+	}
+}
+
+func TestInjectCookie(t *testing.T) {
+	request := &model.HTTPRequest{
+		Headers: map[string][]string{"Cookie": {"session=abc; theme=dark"}},
+		Cookies: map[string]string{"session": "abc", "theme": "dark"},
+	}
+
+	candidate, err := inject(request, model.ParamCookie, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"session=abc; theme=dark; debug=c0ffee; x-role=admin"}
+	if !reflect.DeepEqual(candidate.Headers["Cookie"], want) {
+		t.Errorf("Cookie = %q, want %q", candidate.Headers["Cookie"], want)
+	}
+	if request.Headers["Cookie"][0] != "session=abc; theme=dark" {
+		t.Errorf("original Cookie header changed to %q", request.Headers["Cookie"])
+	}
+
+	// Without a Cookie header the cookies map is what BuildRequest sends.
+	request = &model.HTTPRequest{Cookies: map[string]string{"session": "abc"}}
+	candidate, err = inject(request, model.ParamCookie, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantCookies := map[string]string{"session": "abc", "debug": "c0ffee", "x-role": "admin"}
+	if !reflect.DeepEqual(candidate.Cookies, wantCookies) {
+		t.Errorf("cookies = %v, want %v", candidate.Cookies, wantCookies)
+	}
+	if len(request.Cookies) != 1 {
+		t.Errorf("original cookies changed to %v", request.Cookies)
+	}
+}
+
+func TestInjectHeader(t *testing.T) {
+	request := &model.HTTPRequest{Headers: map[string][]string{"Accept": {"*/*"}}}
+
+	candidate, err := inject(request, model.ParamHeader, testBatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{"Accept": {"*/*"}, "Debug": {"c0ffee"}, "X-Role": {"admin"}}
+	if !reflect.DeepEqual(candidate.Headers, want) {
+		t.Errorf("headers = %v, want %v", candidate.Headers, want)
+	}
+	if len(request.Headers) != 1 {
+		t.Errorf("original headers changed to %v", request.Headers)
+	}
+}
+
+func TestAcceptsCandidate(t *testing.T) {
+	request := &model.HTTPRequest{
+		QueryParams: map[string][]string{"id": {"1"}},
+		Headers:     map[string][]string{"X-Token": {"t"}},
+		Cookies:     map[string]string{"session": "abc"},
+		Body:        []byte(`{"user": "bob"} name=x`),
+	}
+
+	tests := []struct {
+		location model.ParamLocation
+		name     string
+		want     bool
+	}{
+		{location: model.ParamQuery, name: "debug", want: true},
+		{location: model.ParamQuery, name: "id", want: false},
+		{location: model.ParamJSON, name: "debug", want: true},
+		{location: model.ParamJSON, name: "user", want: false},
+		{location: model.ParamForm, name: "name", want: false},
+		{location: model.ParamCookie, name: "debug", want: true},
+		{location: model.ParamCookie, name: "session", want: false},
+		{location: model.ParamCookie, name: "a;b", want: false},
+		{location: model.ParamHeader, name: "x-token", want: false},
+		{location: model.ParamHeader, name: "x-debug", want: true},
+		{location: model.ParamHeader, name: "bad header", want: false},
+		{location: model.ParamHeader, name: "", want: false},
+		{location: "body", name: "debug", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := acceptsCandidate(request, tt.location, tt.name); got != tt.want {
+			t.Errorf("acceptsCandidate(%s, %q) = %v, want %v", tt.location, tt.name, got, tt.want)
+		}
+	}
+}
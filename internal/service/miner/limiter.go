@@ -0,0 +1,38 @@
+package miner
+
+import (
+	"context"
+	"sync"
+)
+
+// hostLimiter bounds the number of in-flight param-miner requests per
+// target host, shared by every scan running in the process.
+type hostLimiter struct {
+	size  int
+	mutex sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func newHostLimiter(size int) *hostLimiter {
+	return &hostLimiter{
+		size:  size,
+		slots: make(map[string]chan struct{}),
+	}
+}
+
+func (l *hostLimiter) acquire(ctx context.Context, host string) (func(), error) {
+	l.mutex.Lock()
+	slots, ok := l.slots[host]
+	if !ok {
+		slots = make(chan struct{}, l.size)
+		l.slots[host] = slots
+	}
+	l.mutex.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,243 @@
+package miner
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"simple_proxy/internal/model"
+	"simple_proxy/internal/service/parser"
+	"strings"
+	"sync"
+)
+
+const (
+	maxURLLength = 4096
+	hostWorkers  = 8
+	valueLength  = 6
+)
+
+type ParamMiner struct {
+	client     *http.Client
+	parser     *parser.HTTPParser
+	params     []string
+	thresholds Thresholds
+	limiter    *hostLimiter
+}
+
+type Result struct {
+	Findings []model.ParamFinding
+	Tested   int
+	Requests int
+}
+
+func NewParamMiner(client *http.Client, params []string, thresholds Thresholds) *ParamMiner {
+	if thresholds.Baselines < 1 {
+		thresholds.Baselines = 1
+	}
+
+	return &ParamMiner{
+		client:     client,
+		parser:     parser.NewHTTPParser(0),
+		params:     params,
+		thresholds: thresholds,
+		limiter:    newHostLimiter(hostWorkers),
+	}
+}
+
+func LoadParams(filePath string) ([]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var params []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		param := strings.TrimSpace(scanner.Text())
+		if param != "" {
+			params = append(params, param)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func generateRandomValue(length int) string {
+	bytes := make([]byte, length)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		return "randomvalue123456789"
+	}
+	return hex.EncodeToString(bytes)
+}
+
+func (m *ParamMiner) Mine(ctx context.Context, request *model.HTTPRequest, location model.ParamLocation) (*Result, error) {
+	result := &Result{Findings: []model.ParamFinding{}}
+
+	// Probes built from a cut body would not resemble the original request.
+	if request.BodyTruncated {
+		return result, fmt.Errorf("%w: request body was truncated when stored", model.ErrUnsupported)
+	}
+
+	baselines := make([]*responseProfile, 0, m.thresholds.Baselines)
+	for range m.thresholds.Baselines {
+		baseline, err := m.probe(ctx, request, location, nil)
+		if err != nil {
+			return result, err
+		}
+		baselines = append(baselines, baseline)
+		result.Requests++
+	}
+	detector := newDetector(baselines, m.thresholds)
+
+	batches, err := m.batches(request, location)
+	if err != nil {
+		return result, err
+	}
+
+	log.Printf("Param-miner split %d params into %d %s batches for %s\n", len(m.params), len(batches), location, request.TargetHost)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, batch := range batches {
+		wg.Add(1)
+		go func(batch []model.ParamFinding) {
+			defer wg.Done()
+
+			found, requests, ok := m.bisect(ctx, request, location, detector, batch)
+
+			mu.Lock()
+			defer mu.Unlock()
+			result.Findings = append(result.Findings, found...)
+			result.Requests += requests
+			if ok {
+				result.Tested += len(batch)
+			}
+		}(batch)
+	}
+
+	wg.Wait()
+
+	return result, ctx.Err()
+}
+
+// batches packs candidate params into groups that keep the injected data
+// within maxInjectedLength and, for query params, the URL under maxURLLength.
+func (m *ParamMiner) batches(request *model.HTTPRequest, location model.ParamLocation) ([][]model.ParamFinding, error) {
+	baseLength, limit := 0, maxInjectedLength
+	if location == model.ParamQuery {
+		base, err := m.parser.BuildRequest(request)
+		if err != nil {
+			return nil, err
+		}
+		baseLength, limit = len(base.URL.String()), maxURLLength
+	}
+
+	var batches [][]model.ParamFinding
+	var batch []model.ParamFinding
+	length := baseLength
+
+	for _, param := range m.params {
+		if !acceptsCandidate(request, location, param) {
+			continue
+		}
+
+		candidate := model.ParamFinding{
+			Name:     param,
+			Value:    generateRandomValue(valueLength),
+			Location: location,
+		}
+		size := candidateSize(location, candidate)
+
+		full := length+size > limit || location == model.ParamHeader && len(batch) >= maxHeaderBatch
+		if len(batch) > 0 && full {
+			batches = append(batches, batch)
+			batch = nil
+			length = baseLength
+		}
+
+		batch = append(batch, candidate)
+		length += size
+	}
+
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+
+	return batches, nil
+}
+
+// bisect probes the whole batch and keeps halving the ones that change the
+// response until the responsible params are isolated.
+func (m *ParamMiner) bisect(ctx context.Context, request *model.HTTPRequest, location model.ParamLocation, detector *detector, batch []model.ParamFinding) ([]model.ParamFinding, int, bool) {
+	resp, err := m.probe(ctx, request, location, batch)
+	if err != nil {
+		log.Printf("Error performing param-miner request to %s: %v\n", request.TargetHost, err)
+		return nil, 0, false
+	}
+
+	reason := detector.changed(resp, batch)
+	if reason == "" {
+		return nil, 1, true
+	}
+
+	if len(batch) == 1 {
+		log.Printf("FOUND HIDDEN PARAMETER: %s (%s)\n", batch[0].Name, reason)
+		finding := batch[0]
+		finding.Reason = reason
+		return []model.ParamFinding{finding}, 1, true
+	}
+
+	mid := len(batch) / 2
+	left, leftRequests, _ := m.bisect(ctx, request, location, detector, batch[:mid])
+	right, rightRequests, _ := m.bisect(ctx, request, location, detector, batch[mid:])
+
+	return append(left, right...), 1 + leftRequests + rightRequests, true
+}
+
+func (m *ParamMiner) probe(ctx context.Context, request *model.HTTPRequest, location model.ParamLocation, batch []model.ParamFinding) (*responseProfile, error) {
+	candidate, err := inject(request, location, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := m.parser.BuildRequest(candidate)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	release, err := m.limiter.acquire(ctx, request.TargetHost)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// The replayed Accept-Encoding gets compressed responses back, and the
+	// shared transport leaves them that way; profiles compare plain text.
+	m.parser.DecodeResponseBody(resp)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return newResponseProfile(resp.StatusCode, resp.Header, string(body)), nil
+}
@@ -0,0 +1,134 @@
+package miner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"simple_proxy/internal/model"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMineFindsHiddenParam(t *testing.T) {
+	var requests, inFlight, maxInFlight atomic.Int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			peak := maxInFlight.Load()
+			if current <= peak || maxInFlight.CompareAndSwap(peak, current) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+
+		// A per-response nonce of constant length is dynamic noise the
+		// baselines have to absorb.
+		fmt.Fprintf(w, "<html>page %d</html>", time.Now().UnixNano()%9000+1000)
+		if r.URL.Query().Has("debug") {
+			fmt.Fprint(w, "<pre>debug mode enabled, dumping internal state</pre>")
+		}
+	}))
+	defer upstream.Close()
+
+	params := []string{"debug", "id"}
+	for i := range 2000 {
+		params = append(params, fmt.Sprintf("param%d", i))
+	}
+
+	m := NewParamMiner(upstream.Client(), params, Thresholds{Baselines: 3, LengthDelta: 16, WordDelta: 2})
+	request := &model.HTTPRequest{
+		Method:      http.MethodGet,
+		Scheme:      "http",
+		Path:        "/page",
+		QueryParams: map[string][]string{"id": {"1"}},
+		Headers:     map[string][]string{},
+		TargetHost:  mustHost(t, upstream.URL),
+	}
+
+	result, err := m.Mine(context.Background(), request, model.ParamQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Findings) != 1 || result.Findings[0].Name != "debug" {
+		t.Fatalf("findings = %+v, want only debug", result.Findings)
+	}
+	if result.Tested != len(params)-1 {
+		t.Errorf("tested %d params, want %d (id is already present)", result.Tested, len(params)-1)
+	}
+	if got := requests.Load(); got != int64(result.Requests) || got > int64(len(params)/20) {
+		t.Errorf("sent %d requests (reported %d) for %d params", got, result.Requests, len(params))
+	}
+	if peak := maxInFlight.Load(); peak > hostWorkers {
+		t.Errorf("%d requests in flight to one host, limit is %d", peak, hostWorkers)
+	}
+}
+
+func TestMineRejectsTruncatedBody(t *testing.T) {
+	m := NewParamMiner(http.DefaultClient, []string{"debug"}, Thresholds{})
+	request := &model.HTTPRequest{Method: http.MethodPost, TargetHost: "example.com", BodyTruncated: true}
+
+	_, err := m.Mine(context.Background(), request, model.ParamForm)
+	if err == nil {
+		t.Fatal("mining a truncated request succeeded")
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(2)
+	ctx := context.Background()
+
+	var releases []func()
+	for range 2 {
+		release, err := limiter.acquire(ctx, "a.example")
+		if err != nil {
+			t.Fatal(err)
+		}
+		releases = append(releases, release)
+	}
+
+	// Other hosts have their own slots.
+	release, err := limiter.acquire(ctx, "b.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = limiter.acquire(timeout, "a.example")
+	if err == nil {
+		t.Fatal("acquired a third slot for a host limited to two")
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		release, err := limiter.acquire(ctx, "a.example")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		release()
+	}()
+	releases[0]()
+	wg.Wait()
+	releases[1]()
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
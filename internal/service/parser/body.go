@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+var textMediaTypes = map[string]bool{
+	"application/json":                  true,
+	"application/javascript":            true,
+	"application/ecmascript":            true,
+	"application/xml":                   true,
+	"application/xhtml+xml":             true,
+	"application/x-www-form-urlencoded": true,
+	"application/graphql":               true,
+	"image/svg+xml":                     true,
+}
+
+func isTextMediaType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		textMediaTypes[mediaType]
+}
+
+// detectCharset returns the charset of a text-like body, or "" for binary
+// content. The declared Content-Type wins; without one the type is sniffed
+// from the body itself.
+func detectCharset(body []byte, contentType string) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	if contentType == "" {
+		contentType = http.DetectContentType(body)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !isTextMediaType(mediaType) {
+		return ""
+	}
+
+	if declared := params["charset"]; declared != "" {
+		if _, name := charset.Lookup(declared); name != "" {
+			return name
+		}
+	}
+
+	if utf8.Valid(trimPartialRune(body)) {
+		return "utf-8"
+	}
+
+	_, name, _ := charset.DetermineEncoding(body, contentType)
+	return name
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence at the end of body,
+// which is left behind when a capture is cut at the body limit.
+func trimPartialRune(body []byte) []byte {
+	for i := 1; i <= utf8.UTFMax && i <= len(body); i++ {
+		if utf8.RuneStart(body[len(body)-i]) {
+			if !utf8.FullRune(body[len(body)-i:]) {
+				return body[:len(body)-i]
+			}
+			break
+		}
+	}
+	return body
+}
@@ -0,0 +1,113 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+)
+
+// BodyCapture sits between a body and whoever consumes it, keeping a copy
+// of the first limit bytes for storage while the rest only flows through.
+// Finish hands the captured body to the record being built.
+type BodyCapture struct {
+	src   io.ReadCloser
+	limit int64
+
+	mutex  sync.Mutex
+	buf    bytes.Buffer
+	size   int64
+	eof    bool
+	once   sync.Once
+	finish func(body []byte, size int64, complete bool)
+	ended  bool
+	hooks  []func()
+	done   chan struct{}
+}
+
+func newBodyCapture(src io.ReadCloser, limit int64, finish func(body []byte, size int64, complete bool)) *BodyCapture {
+	return &BodyCapture{
+		src:    src,
+		limit:  limit,
+		finish: finish,
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *BodyCapture) Read(p []byte) (int, error) {
+	n, err := c.src.Read(p)
+
+	c.mutex.Lock()
+	c.size += int64(n)
+	if room := c.limit - int64(c.buf.Len()); c.limit <= 0 || room > 0 {
+		chunk := p[:n]
+		if c.limit > 0 && int64(len(chunk)) > room {
+			chunk = chunk[:room]
+		}
+		c.buf.Write(chunk)
+	}
+	if errors.Is(err, io.EOF) {
+		c.eof = true
+	}
+	c.mutex.Unlock()
+
+	if errors.Is(err, io.EOF) {
+		c.Finish()
+	}
+
+	return n, err
+}
+
+func (c *BodyCapture) Close() error {
+	err := c.src.Close()
+	c.Finish()
+	return err
+}
+
+// Finish stores what has been captured so far. Only the first call has an
+// effect; a body that was not read to the end is stored as truncated.
+func (c *BodyCapture) Finish() {
+	c.once.Do(func() {
+		c.mutex.Lock()
+		body := bytes.Clone(c.buf.Bytes())
+		size, complete := c.size, c.eof && int64(len(body)) == c.size
+		c.mutex.Unlock()
+
+		c.finish(body, size, complete)
+
+		c.mutex.Lock()
+		c.ended = true
+		hooks := c.hooks
+		c.hooks = nil
+		c.mutex.Unlock()
+
+		for _, hook := range hooks {
+			hook()
+		}
+		close(c.done)
+	})
+}
+
+// OnFinish registers fn to run once the record has its body, right away
+// when Finish already happened.
+func (c *BodyCapture) OnFinish(fn func()) {
+	c.mutex.Lock()
+	if !c.ended {
+		c.hooks = append(c.hooks, fn)
+		c.mutex.Unlock()
+		return
+	}
+	c.mutex.Unlock()
+
+	fn()
+}
+
+// Wait blocks until Finish has run and every OnFinish hook returned.
+func (c *BodyCapture) Wait() {
+	<-c.done
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
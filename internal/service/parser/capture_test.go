@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type captured struct {
+	body     []byte
+	size     int64
+	complete bool
+	calls    int
+}
+
+func newTestCapture(data string, limit int64) (*BodyCapture, *captured) {
+	result := &captured{}
+	capture := newBodyCapture(io.NopCloser(strings.NewReader(data)), limit, func(body []byte, size int64, complete bool) {
+		result.body = body
+		result.size = size
+		result.complete = complete
+		result.calls++
+	})
+	return capture, result
+}
+
+func TestBodyCapture(t *testing.T) {
+	data := strings.Repeat("0123456789", 10)
+
+	tests := []struct {
+		name         string
+		limit        int64
+		read         int // bytes consumed before Close, -1 reads to the end
+		wantBody     string
+		wantSize     int64
+		wantComplete bool
+	}{
+		{name: "no limit", limit: 0, read: -1, wantBody: data, wantSize: 100, wantComplete: true},
+		{name: "under limit", limit: 200, read: -1, wantBody: data, wantSize: 100, wantComplete: true},
+		{name: "exactly the limit", limit: 100, read: -1, wantBody: data, wantSize: 100, wantComplete: true},
+		{name: "over limit", limit: 30, read: -1, wantBody: data[:30], wantSize: 100, wantComplete: false},
+		{name: "closed early", limit: 0, read: 40, wantBody: data[:40], wantSize: 40, wantComplete: false},
+		{name: "closed early over limit", limit: 10, read: 40, wantBody: data[:10], wantSize: 40, wantComplete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			capture, result := newTestCapture(data, tt.limit)
+
+			var forwarded []byte
+			var err error
+			if tt.read < 0 {
+				forwarded, err = io.ReadAll(capture)
+			} else {
+				forwarded = make([]byte, tt.read)
+				_, err = io.ReadFull(capture, forwarded)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			capture.Close()
+
+			if tt.read < 0 && string(forwarded) != data {
+				t.Errorf("forwarded %d bytes, want the whole body", len(forwarded))
+			}
+			if string(result.body) != tt.wantBody || result.size != tt.wantSize || result.complete != tt.wantComplete {
+				t.Errorf("captured %d bytes, size %d, complete %v, want %d bytes, size %d, complete %v",
+					len(result.body), result.size, result.complete, len(tt.wantBody), tt.wantSize, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestBodyCaptureFinishesOnce(t *testing.T) {
+	capture, result := newTestCapture("body", 0)
+
+	var hooks int
+	capture.OnFinish(func() { hooks++ })
+
+	io.ReadAll(capture)
+	capture.Close()
+	capture.Finish()
+	capture.Wait()
+
+	if result.calls != 1 || hooks != 1 {
+		t.Fatalf("finish ran %d times and hooks %d times, want once each", result.calls, hooks)
+	}
+
+	capture.OnFinish(func() { hooks++ })
+	if hooks != 2 {
+		t.Error("hook registered after Finish did not run right away")
+	}
+}
+
+func TestParseRequestBodyPendingUntilFinish(t *testing.T) {
+	r, err := http.NewRequest(http.MethodPost, "http://example.com/form", bytes.NewBufferString("a=1&b=2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	req, capture := NewHTTPParser(0).ParseRequest(r)
+	if !req.BodyTruncated {
+		t.Error("request body counts as complete before it was sent")
+	}
+
+	io.ReadAll(r.Body)
+	capture.Wait()
+
+	if req.BodyTruncated || string(req.Body) != "a=1&b=2" || req.BodySize != 7 {
+		t.Errorf("got body %q, size %d, truncated %v", req.Body, req.BodySize, req.BodyTruncated)
+	}
+	if req.FormParams["b"][0] != "2" {
+		t.Errorf("got form params %v", req.FormParams)
+	}
+}
@@ -0,0 +1,257 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// maxDecoderMemory bounds the window a zstd stream may ask the decoder to
+// allocate.
+const maxDecoderMemory = 64 << 20
+
+type decoderFunc func(io.Reader) (io.ReadCloser, error)
+
+type encoderFunc func(io.Writer) (io.WriteCloser, error)
+
+// decoders maps Content-Encoding tokens to streaming decoders and the
+// matching encoders. magic, when known, lets a body that does not actually
+// use the encoding pass through untouched.
+var decoders = map[string]struct {
+	decode decoderFunc
+	encode encoderFunc
+	magic  []byte
+}{
+	"gzip":    {decode: newGzipReader, encode: newGzipWriter, magic: []byte{0x1f, 0x8b}},
+	"x-gzip":  {decode: newGzipReader, encode: newGzipWriter, magic: []byte{0x1f, 0x8b}},
+	"deflate": {decode: newDeflateReader, encode: newDeflateWriter},
+	"br":      {decode: newBrotliReader, encode: newBrotliWriter},
+	"zstd":    {decode: newZstdReader, encode: newZstdWriter, magic: []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+func newGzipReader(r io.Reader) (io.ReadCloser, error) {
+	return gzip.NewReader(r)
+}
+
+// newDeflateReader accepts the zlib wrapped stream the spec asks for as
+// well as the raw deflate some servers send instead.
+func newDeflateReader(r io.Reader) (io.ReadCloser, error) {
+	buffered := bufio.NewReader(r)
+
+	header, err := buffered.Peek(2)
+	if err == nil && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(buffered)
+	}
+
+	return flate.NewReader(buffered), nil
+}
+
+func newBrotliReader(r io.Reader) (io.ReadCloser, error) {
+	return io.NopCloser(brotli.NewReader(r)), nil
+}
+
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(maxDecoderMemory))
+	if err != nil {
+		return nil, err
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func newGzipWriter(w io.Writer) (io.WriteCloser, error) {
+	return gzip.NewWriter(w), nil
+}
+
+func newDeflateWriter(w io.Writer) (io.WriteCloser, error) {
+	return zlib.NewWriter(w), nil
+}
+
+func newBrotliWriter(w io.Writer) (io.WriteCloser, error) {
+	return brotli.NewWriter(w), nil
+}
+
+func newZstdWriter(w io.Writer) (io.WriteCloser, error) {
+	return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1))
+}
+
+// contentEncodings lists the codings of h in the order they were applied.
+// It reports false when one of them has no decoder.
+func contentEncodings(h http.Header) ([]string, bool) {
+	var encodings []string
+	for _, value := range h.Values("Content-Encoding") {
+		for _, token := range strings.Split(value, ",") {
+			token = strings.ToLower(strings.TrimSpace(token))
+			if token == "" || token == "identity" {
+				continue
+			}
+			if _, ok := decoders[token]; !ok {
+				return nil, false
+			}
+			encodings = append(encodings, token)
+		}
+	}
+	return encodings, true
+}
+
+// decodeReader unwraps the codings in reverse order of application.
+func decodeReader(r io.Reader, encodings []string) (io.Reader, []io.Closer, error) {
+	var closers []io.Closer
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoder, err := decoders[encodings[i]].decode(r)
+		if err != nil {
+			closeAll(closers)
+			return nil, nil, err
+		}
+		closers = append(closers, decoder)
+		r = decoder
+	}
+	return r, closers, nil
+}
+
+func closeAll(closers []io.Closer) {
+	for i := len(closers) - 1; i >= 0; i-- {
+		closers[i].Close()
+	}
+}
+
+// decodeBody decodes a captured body for storage, keeping at most limit
+// decoded bytes (no limit when 0) and reporting whether the output was cut.
+// A capture cut at the body limit still yields its readable prefix; ok is
+// false when nothing could be decoded and data should be kept as is.
+func decodeBody(data []byte, encodings []string, limit int64) (decoded []byte, ok bool, cut bool) {
+	if len(encodings) == 0 || len(data) == 0 {
+		return data, len(encodings) == 0, false
+	}
+
+	reader, closers, err := decodeReader(bytes.NewReader(data), encodings)
+	if err != nil {
+		return data, false, false
+	}
+	defer closeAll(closers)
+
+	if limit > 0 {
+		reader = io.LimitReader(reader, limit+1)
+	}
+
+	decoded, err = io.ReadAll(reader)
+	if err != nil && len(decoded) == 0 {
+		return data, false, false
+	}
+
+	if limit > 0 && int64(len(decoded)) > limit {
+		return decoded[:limit], true, true
+	}
+
+	return decoded, true, false
+}
+
+type decodedBody struct {
+	io.Reader
+	body     io.Closer
+	decoders []io.Closer
+}
+
+func (d *decodedBody) Close() error {
+	closeAll(d.decoders)
+	return d.body.Close()
+}
+
+// decodeStream replaces body with a streaming decoder for encodings. The
+// body is left untouched, and false returned, when its first bytes do not
+// match the outermost coding.
+func decodeStream(body io.ReadCloser, encodings []string) (io.ReadCloser, bool) {
+	buffered := bufio.NewReader(body)
+	passthrough := readCloser{Reader: buffered, Closer: body}
+
+	if _, err := buffered.Peek(1); err != nil {
+		return passthrough, false
+	}
+	if magic := decoders[encodings[len(encodings)-1]].magic; magic != nil {
+		head, err := buffered.Peek(len(magic))
+		if err != nil || !bytes.Equal(head, magic) {
+			return passthrough, false
+		}
+	}
+
+	reader, closers, err := decodeReader(buffered, encodings)
+	if err != nil {
+		return passthrough, false
+	}
+
+	return &decodedBody{Reader: reader, body: body, decoders: closers}, true
+}
+
+type flusher interface {
+	Flush() error
+}
+
+// encodeStream compresses body with encodings, applied in order, as it is
+// read. Every chunk read from body is flushed through so streamed responses
+// keep arriving while they are produced.
+func encodeStream(body io.ReadCloser, encodings []string) (io.ReadCloser, error) {
+	pipeReader, pipeWriter := io.Pipe()
+
+	writers := make([]io.WriteCloser, len(encodings))
+	var dst io.Writer = pipeWriter
+	for i := len(encodings) - 1; i >= 0; i-- {
+		writer, err := decoders[encodings[i]].encode(dst)
+		if err != nil {
+			return nil, err
+		}
+		writers[i] = writer
+		dst = writer
+	}
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := body.Read(buf)
+			if n > 0 {
+				if _, writeErr := writers[0].Write(buf[:n]); writeErr != nil {
+					pipeWriter.CloseWithError(writeErr)
+					return
+				}
+				for _, writer := range writers {
+					if f, ok := writer.(flusher); ok {
+						f.Flush()
+					}
+				}
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+
+		for _, writer := range writers {
+			if err := writer.Close(); err != nil {
+				pipeWriter.CloseWithError(err)
+				return
+			}
+		}
+		pipeWriter.Close()
+	}()
+
+	return readCloser{Reader: pipeReader, Closer: closerFunc(func() error {
+		pipeReader.Close()
+		return body.Close()
+	})}, nil
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
@@ -0,0 +1,166 @@
+package parser
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// encode compresses data with encodings applied in order, using the
+// registry's own encoders.
+func encode(t *testing.T, data []byte, encodings ...string) []byte {
+	t.Helper()
+
+	for _, encoding := range encodings {
+		var buf bytes.Buffer
+		writer, err := decoders[encoding].encode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = writer.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = buf.Bytes()
+	}
+	return data
+}
+
+func TestContentEncodings(t *testing.T) {
+	tests := []struct {
+		name          string
+		values        []string
+		want          []string
+		wantSupported bool
+	}{
+		{name: "none", wantSupported: true},
+		{name: "gzip", values: []string{"gzip"}, want: []string{"gzip"}, wantSupported: true},
+		{name: "case and spaces", values: []string{" BR "}, want: []string{"br"}, wantSupported: true},
+		{name: "stacked in one header", values: []string{"gzip, br"}, want: []string{"gzip", "br"}, wantSupported: true},
+		{name: "stacked across headers", values: []string{"deflate", "zstd"}, want: []string{"deflate", "zstd"}, wantSupported: true},
+		{name: "identity is skipped", values: []string{"identity, x-gzip"}, want: []string{"x-gzip"}, wantSupported: true},
+		{name: "unknown coding", values: []string{"gzip, compress"}, wantSupported: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for _, value := range tt.values {
+				header.Add("Content-Encoding", value)
+			}
+
+			got, supported := contentEncodings(header)
+			if supported != tt.wantSupported || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("contentEncodings(%q) = %q, %v, want %q, %v", tt.values, got, supported, tt.want, tt.wantSupported)
+			}
+		})
+	}
+}
+
+func TestDecodeBody(t *testing.T) {
+	text := bytes.Repeat([]byte("hello encoded world\n"), 100)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		encodings []string
+		want      []byte
+		wantOK    bool
+	}{
+		{name: "gzip", data: encode(t, text, "gzip"), encodings: []string{"gzip"}, want: text, wantOK: true},
+		{name: "deflate", data: encode(t, text, "deflate"), encodings: []string{"deflate"}, want: text, wantOK: true},
+		{name: "raw deflate", data: rawDeflate(t, text), encodings: []string{"deflate"}, want: text, wantOK: true},
+		{name: "br", data: encode(t, text, "br"), encodings: []string{"br"}, want: text, wantOK: true},
+		{name: "zstd", data: encode(t, text, "zstd"), encodings: []string{"zstd"}, want: text, wantOK: true},
+		{name: "stacked", data: encode(t, text, "gzip", "br"), encodings: []string{"gzip", "br"}, want: text, wantOK: true},
+		{name: "truncated capture keeps the prefix", data: encode(t, text, "gzip")[:40], encodings: []string{"gzip"}, wantOK: true},
+		{name: "not actually compressed", data: text, encodings: []string{"gzip"}, want: text, wantOK: false},
+		{name: "no encodings", data: text, want: text, wantOK: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok, cut := decodeBody(tt.data, tt.encodings, 0)
+			if ok != tt.wantOK || cut {
+				t.Fatalf("ok, cut = %v, %v, want %v, false", ok, cut, tt.wantOK)
+			}
+			if tt.want == nil {
+				if len(got) == 0 || !bytes.HasPrefix(text, got) {
+					t.Errorf("decoded %q, want a prefix of the original", got)
+				}
+				return
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("decoded %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestDecodeBodyLimit(t *testing.T) {
+	bomb := encode(t, make([]byte, 64<<20), "gzip")
+
+	decoded, ok, cut := decodeBody(bomb, []string{"gzip"}, 1<<20)
+	if !ok || !cut {
+		t.Fatalf("ok, cut = %v, %v, want true, true", ok, cut)
+	}
+	if len(decoded) != 1<<20 {
+		t.Errorf("decoded %d bytes, want %d", len(decoded), 1<<20)
+	}
+
+	decoded, ok, cut = decodeBody(encode(t, []byte("small"), "gzip"), []string{"gzip"}, 1<<20)
+	if !ok || cut || string(decoded) != "small" {
+		t.Errorf("decodeBody = %q, %v, %v, want \"small\", true, false", decoded, ok, cut)
+	}
+}
+
+func TestDecodeStreamRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte("stream me\n"), 500)
+	encodings := []string{"deflate", "zstd"}
+
+	encoded, err := encodeStream(io.NopCloser(bytes.NewReader(text)), encodings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, ok := decodeStream(encoded, encodings)
+	if !ok {
+		t.Fatal("decodeStream did not recognise the encoded body")
+	}
+	defer decoded.Close()
+
+	got, err := io.ReadAll(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, text) {
+		t.Errorf("round trip returned %d bytes, want %d", len(got), len(text))
+	}
+}
+
+func TestDecodeStreamLeavesMismatchedBody(t *testing.T) {
+	body, ok := decodeStream(io.NopCloser(bytes.NewReader([]byte("plain text"))), []string{"gzip"})
+	if ok {
+		t.Fatal("plain body was treated as gzip")
+	}
+
+	got, _ := io.ReadAll(body)
+	if string(got) != "plain text" {
+		t.Errorf("body = %q, want it unchanged", got)
+	}
+}
+
+func rawDeflate(t *testing.T, data []byte) []byte {
+	t.Helper()
+
+	// A zlib stream without its 2-byte header and 4-byte checksum is the raw
+	// deflate some servers send.
+	wrapped := encode(t, data, "deflate")
+	return wrapped[2 : len(wrapped)-4]
+}
@@ -2,23 +2,36 @@ package parser
 
 import (
 	"bytes"
-	"compress/gzip"
-	"io"
 	"net/http"
+	"net/url"
 	"simple_proxy/internal/model"
 	"strings"
 )
 
-type HTTPParser struct{}
+// HTTPParser turns requests and responses into records. Bodies are not
+// read up front: they are captured while being forwarded, keeping at most
+// bodyLimit bytes (no limit when 0).
+type HTTPParser struct {
+	bodyLimit int64
+}
 
-func NewHTTPParser() *HTTPParser {
-	return &HTTPParser{}
+func NewHTTPParser(bodyLimit int64) *HTTPParser {
+	return &HTTPParser{
+		bodyLimit: bodyLimit,
+	}
 }
 
-func (p *HTTPParser) ParseRequest(r *http.Request) (*model.HTTPRequest, []byte, error) {
+// ParseRequest records r and wraps its body so it is captured as it is
+// sent upstream. The record's body is filled in by BodyCapture.Finish;
+// until then it counts as truncated.
+func (p *HTTPParser) ParseRequest(r *http.Request) (*model.HTTPRequest, *BodyCapture) {
 	req := &model.HTTPRequest{
 		Method:      r.Method,
+		Scheme:      r.URL.Scheme,
+		Proto:       r.Proto,
 		Path:        r.URL.Path,
+		RawPath:     r.URL.RawPath,
+		RawQuery:    r.URL.RawQuery,
 		QueryParams: make(map[string][]string),
 		Headers:     make(map[string][]string),
 		Cookies:     make(map[string]string),
@@ -43,59 +56,59 @@ func (p *HTTPParser) ParseRequest(r *http.Request) (*model.HTTPRequest, []byte,
 	if r.Header.Get("Content-Encoding") == "gzip" {
 		req.IsGzipped = true
 	}
-
-	var bodyBytes []byte
-	var err error
-
-	if r.Body != nil {
-		bodyBytes, err = io.ReadAll(r.Body)
-		if err != nil {
-			return nil, nil, err
-		}
-		r.Body.Close()
-
-		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-
-		if req.IsGzipped {
-			reader, err := gzip.NewReader(bytes.NewBuffer(bodyBytes))
-			if err == nil {
-				unzippedBytes, err := io.ReadAll(reader)
-				reader.Close()
-				if err == nil {
-					req.Body = string(unzippedBytes)
-				} else {
-					req.Body = string(bodyBytes)
-				}
-			} else {
-				req.Body = string(bodyBytes)
+	encodings, supported := contentEncodings(r.Header)
+
+	capture := newBodyCapture(r.Body, p.bodyLimit, func(body []byte, size int64, complete bool) {
+		if supported {
+			decoded, ok, cut := decodeBody(body, encodings, p.bodyLimit)
+			if ok {
+				body = decoded
+				complete = complete && !cut
+				req.Encodings = encodings
 			}
-		} else {
-			req.Body = string(bodyBytes)
 		}
-
 		contentType := r.Header.Get("Content-Type")
+
+		req.Body = body
+		req.BodySize = size
+		req.BodyTruncated = !complete
+		req.Charset = detectCharset(body, contentType)
+		req.BodyText = model.TextView(body, req.Charset)
+
 		if strings.Contains(contentType, "application/x-www-form-urlencoded") {
-			err = r.ParseForm()
+			form, err := url.ParseQuery(req.BodyText)
 			if err == nil {
-				for key, values := range r.PostForm {
+				for key, values := range form {
 					req.FormParams[key] = values
 				}
 			}
 		}
+	})
+
+	if r.Body == nil || r.Body == http.NoBody {
+		capture.eof = true
+		capture.Finish()
+	} else {
+		req.BodyTruncated = true
+		r.Body = capture
 	}
 
-	return req, bodyBytes, nil
+	return req, capture
 }
 
-func (p *HTTPParser) ParseResponse(resp *http.Response, requestID string) (*model.HTTPResponse, []byte, error) {
+// ParseResponse records resp and wraps its body so it is captured while
+// streamed to the client. done is called with the completed record once
+// the body has been read to the end or closed.
+func (p *HTTPParser) ParseResponse(resp *http.Response, requestID string, done func(*model.HTTPResponse)) (*model.HTTPResponse, error) {
 	requestIDObj, err := model.StringToObjectID(requestID)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	res := &model.HTTPResponse{
 		RequestID:     requestIDObj,
 		StatusCode:    resp.StatusCode,
+		Proto:         resp.Proto,
 		Headers:       make(map[string][]string),
 		ContentType:   resp.Header.Get("Content-Type"),
 		ContentLength: resp.ContentLength,
@@ -109,64 +122,134 @@ func (p *HTTPParser) ParseResponse(resp *http.Response, requestID string) (*mode
 	if resp.Header.Get("Content-Encoding") == "gzip" {
 		res.IsGzipped = true
 	}
-
-	var bodyBytes []byte
-	if resp.Body != nil {
-		bodyBytes, err = io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, nil, err
+	encodings, supported := contentEncodings(resp.Header)
+
+	resp.Body = newBodyCapture(resp.Body, p.bodyLimit, func(body []byte, size int64, complete bool) {
+		if supported {
+			decoded, ok, cut := decodeBody(body, encodings, p.bodyLimit)
+			if ok {
+				body = decoded
+				complete = complete && !cut
+				res.Encodings = encodings
+			}
 		}
-		resp.Body.Close()
+		res.Body = body
+		res.BodySize = size
+		res.BodyTruncated = !complete
+		res.Charset = detectCharset(body, res.ContentType)
+		res.BodyText = model.TextView(body, res.Charset)
 
-		resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		done(res)
+	})
 
-		if res.IsGzipped {
-			reader, err := gzip.NewReader(bytes.NewBuffer(bodyBytes))
-			if err == nil {
-				unzippedBytes, err := io.ReadAll(reader)
-				reader.Close()
-				if err == nil {
-					res.Body = string(unzippedBytes)
-				} else {
-					res.Body = string(bodyBytes)
-				}
-			} else {
-				res.Body = string(bodyBytes)
-			}
-		} else {
-			res.Body = string(bodyBytes)
+	return res, nil
+}
+
+// BuildRequest turns a record back into a request. The path and query are
+// sent as originally received; QueryParams is only encoded for records that
+// have no raw query.
+func (p *HTTPParser) BuildRequest(req *model.HTTPRequest) (*http.Request, error) {
+	scheme := req.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+
+	rawQuery := req.RawQuery
+	if rawQuery == "" {
+		rawQuery = url.Values(req.QueryParams).Encode()
+	}
+
+	target := &url.URL{
+		Scheme:   scheme,
+		Host:     req.TargetHost,
+		Path:     req.Path,
+		RawPath:  req.RawPath,
+		RawQuery: rawQuery,
+	}
+
+	r, err := http.NewRequest(req.Method, target.String(), bytes.NewReader(req.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	for key, values := range req.Headers {
+		r.Header[key] = append([]string(nil), values...)
+	}
+
+	if r.Header.Get("Cookie") == "" {
+		for name, value := range req.Cookies {
+			r.AddCookie(&http.Cookie{Name: name, Value: value})
 		}
 	}
 
-	return res, bodyBytes, nil
+	// Stored bodies are already decompressed.
+	if req.IsGzipped || len(req.Encodings) > 0 {
+		r.Header.Del("Content-Encoding")
+	}
+	r.Header.Del("Content-Length")
+	r.Host = req.TargetHost
+
+	return r, nil
 }
 
-func (p *HTTPParser) ModifyRequestForGzip(r *http.Request, bodyBytes []byte) {
-	if r.Header.Get("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(bytes.NewBuffer(bodyBytes))
-		if err == nil {
-			unzippedBytes, err := io.ReadAll(reader)
-			reader.Close()
-			if err == nil {
-				r.Body = io.NopCloser(bytes.NewBuffer(unzippedBytes))
-				r.ContentLength = int64(len(unzippedBytes))
-				r.Header.Del("Content-Encoding")
-			}
-		}
+// ModifyRequestForGzip replaces a compressed request body with its decoded
+// stream. Bodies with an unknown coding, or whose bytes do not match the
+// declared one, are forwarded untouched.
+func (p *HTTPParser) ModifyRequestForGzip(r *http.Request) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return
+	}
+
+	encodings, supported := contentEncodings(r.Header)
+	if !supported || len(encodings) == 0 {
+		return
+	}
+
+	body, ok := decodeStream(r.Body, encodings)
+	r.Body = body
+	if ok {
+		r.ContentLength = -1
+		r.Header.Del("Content-Encoding")
+		r.Header.Del("Content-Length")
 	}
 }
 
-func (p *HTTPParser) ModifyResponseForGzip(resp *http.Response, bodyBytes []byte) {
-	if resp.Header.Get("Content-Encoding") == "gzip" {
-		reader, err := gzip.NewReader(bytes.NewBuffer(bodyBytes))
-		if err == nil {
-			unzippedBytes, err := io.ReadAll(reader)
-			reader.Close()
-			if err == nil {
-				resp.Body = io.NopCloser(bytes.NewBuffer(unzippedBytes))
-				resp.ContentLength = int64(len(unzippedBytes))
-				resp.Header.Del("Content-Encoding")
-			}
-		}
+// DecodeResponseBody replaces a compressed response body with its decoded
+// stream and returns the codings it removed, nil when the body was left
+// untouched.
+func (p *HTTPParser) DecodeResponseBody(resp *http.Response) []string {
+	encodings, supported := contentEncodings(resp.Header)
+	if !supported || len(encodings) == 0 {
+		return nil
 	}
+
+	body, ok := decodeStream(resp.Body, encodings)
+	resp.Body = body
+	if !ok {
+		return nil
+	}
+
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	return encodings
+}
+
+// EncodeResponseBody compresses the response body again with encodings, as
+// returned by DecodeResponseBody.
+func (p *HTTPParser) EncodeResponseBody(resp *http.Response, encodings []string) error {
+	if len(encodings) == 0 {
+		return nil
+	}
+
+	body, err := encodeStream(resp.Body, encodings)
+	if err != nil {
+		return err
+	}
+
+	resp.Body = body
+	resp.ContentLength = -1
+	resp.Header.Set("Content-Encoding", strings.Join(encodings, ", "))
+	resp.Header.Del("Content-Length")
+	return nil
 }
@@ -0,0 +1,57 @@
+package parser
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"simple_proxy/internal/model"
+	"testing"
+)
+
+func TestBuildRequestKeepsRawTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+	}{
+		{name: "plain", target: "/search?q=1"},
+		{name: "param order", target: "/list?b=2&a=1&b=0"},
+		{name: "escaping", target: "/q?c=%2f&d=a+b&e=%7E&f=x%20y"},
+		{name: "flag without value", target: "/q?debug&x="},
+		{name: "semicolons", target: "/q?a=1;b=2"},
+		{name: "encoded slash in path", target: "/files/a%2Fb/c"},
+		{name: "no query", target: "/"},
+	}
+
+	p := NewHTTPParser(0)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://example.com"+tt.target, nil)
+			req, _ := p.ParseRequest(r)
+
+			rebuilt, err := p.BuildRequest(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := rebuilt.URL.RequestURI(); got != tt.target {
+				t.Errorf("replayed %q, want %q", got, tt.target)
+			}
+		})
+	}
+}
+
+func TestBuildRequestWithoutRawQuery(t *testing.T) {
+	// Records stored before raw queries were kept only have QueryParams.
+	req := &model.HTTPRequest{
+		Method:      http.MethodGet,
+		Path:        "/search",
+		QueryParams: map[string][]string{"q": {"a b"}, "page": {"2"}},
+		TargetHost:  "example.com",
+	}
+
+	rebuilt, err := NewHTTPParser(0).BuildRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := rebuilt.URL.String(); got != "http://example.com/search?page=2&q=a+b" {
+		t.Errorf("rebuilt %q", got)
+	}
+}
@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var errWebSocketFrameLength = errors.New("invalid WebSocket frame length")
+
+// maxControlPayload is the largest payload RFC 6455 allows in a control
+// frame.
+const maxControlPayload = 125
+
+// WebSocketFrame is a relayed frame. Payload holds the unmasked payload up
+// to the body limit, Length the full payload length announced by the
+// frame.
+type WebSocketFrame struct {
+	Fin       bool
+	Opcode    int
+	Length    int64
+	Payload   []byte
+	Truncated bool
+}
+
+// ReadWebSocketFrame reads one frame from r and relays it to dst unchanged
+// as it arrives, so frames of any size pass through without being
+// buffered. The returned frame keeps at most bodyLimit bytes of the
+// payload.
+func (p *HTTPParser) ReadWebSocketFrame(r *bufio.Reader, dst io.Writer) (*WebSocketFrame, error) {
+	header := make([]byte, 2, 14)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, err
+	}
+
+	frame := &WebSocketFrame{
+		Fin:    header[0]&0x80 != 0,
+		Opcode: int(header[0] & 0x0F),
+	}
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	extra := 0
+	switch length {
+	case 126:
+		extra = 2
+	case 127:
+		extra = 8
+	}
+	if masked {
+		extra += 4
+	}
+
+	header = header[:2+extra]
+	_, err = io.ReadFull(r, header[2:])
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+
+	rest := header[2:]
+	switch length {
+	case 126:
+		length = uint64(binary.BigEndian.Uint16(rest))
+		rest = rest[2:]
+	case 127:
+		length = binary.BigEndian.Uint64(rest)
+		rest = rest[8:]
+	}
+
+	// The most significant bit of a 64-bit length must be 0.
+	if length>>63 != 0 || (frame.Opcode >= 0x8 && length > maxControlPayload) {
+		return nil, errWebSocketFrameLength
+	}
+	frame.Length = int64(length)
+
+	var maskKey []byte
+	if masked {
+		maskKey = rest[:4]
+	}
+
+	_, err = dst.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	keep := frame.Length
+	if p.bodyLimit > 0 && keep > p.bodyLimit {
+		keep = p.bodyLimit
+		frame.Truncated = true
+	}
+
+	buf := make([]byte, 32*1024)
+	var offset int64
+	for offset < frame.Length {
+		chunk := buf[:min(int64(len(buf)), frame.Length-offset)]
+		n, err := r.Read(chunk)
+		chunk = chunk[:n]
+
+		if n > 0 {
+			_, writeErr := dst.Write(chunk)
+			if writeErr != nil {
+				return nil, writeErr
+			}
+
+			if room := keep - offset; room > 0 {
+				start := len(frame.Payload)
+				frame.Payload = append(frame.Payload, chunk[:min(int64(n), room)]...)
+				if masked {
+					for i := start; i < len(frame.Payload); i++ {
+						frame.Payload[i] ^= maskKey[i%4]
+					}
+				}
+			}
+			offset += int64(n)
+		}
+
+		if err != nil && offset < frame.Length {
+			return nil, unexpectedEOF(err)
+		}
+	}
+
+	return frame, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
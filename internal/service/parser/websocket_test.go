@@ -0,0 +1,209 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// buildFrame encodes a frame, using the shortest length form unless
+// lengthBytes forces 2 (16-bit) or 8 (64-bit).
+func buildFrame(fin bool, opcode byte, payload, maskKey []byte, lengthBytes int) []byte {
+	first := opcode
+	if fin {
+		first |= 0x80
+	}
+	frame := []byte{first, 0}
+
+	length := len(payload)
+	switch {
+	case lengthBytes == 8 || length > 0xFFFF:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	case lengthBytes == 2 || length > 125:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+	default:
+		frame[1] = byte(length)
+	}
+
+	if maskKey == nil {
+		return append(frame, payload...)
+	}
+
+	frame[1] |= 0x80
+	frame = append(frame, maskKey...)
+	for i, b := range payload {
+		frame = append(frame, b^maskKey[i%4])
+	}
+	return frame
+}
+
+func TestReadWebSocketFrame(t *testing.T) {
+	mask := []byte{0x12, 0x34, 0x56, 0x78}
+	medium := bytes.Repeat([]byte("m"), 300)
+	large := bytes.Repeat([]byte("0123456789"), 7000)
+
+	hugeLength := []byte{0x82, 127}
+	hugeLength = binary.BigEndian.AppendUint64(hugeLength, 0x7FFFFFFFFFFFFFFF)
+	hugeLength = append(hugeLength, "only a few bytes"...)
+
+	invalidLength := []byte{0x82, 127}
+	invalidLength = binary.BigEndian.AppendUint64(invalidLength, 1<<63)
+
+	tests := []struct {
+		name          string
+		limit         int64
+		input         []byte
+		wantErr       error
+		wantOpcode    int
+		wantFin       bool
+		wantLength    int64
+		wantPayload   []byte
+		wantTruncated bool
+	}{
+		{
+			name:        "7-bit length",
+			input:       buildFrame(true, 0x1, []byte("hello"), nil, 0),
+			wantOpcode:  0x1,
+			wantFin:     true,
+			wantLength:  5,
+			wantPayload: []byte("hello"),
+		},
+		{
+			name:        "16-bit length",
+			input:       buildFrame(true, 0x2, medium, nil, 0),
+			wantOpcode:  0x2,
+			wantFin:     true,
+			wantLength:  int64(len(medium)),
+			wantPayload: medium,
+		},
+		{
+			name:        "64-bit length",
+			input:       buildFrame(false, 0x2, large, nil, 0),
+			wantOpcode:  0x2,
+			wantLength:  int64(len(large)),
+			wantPayload: large,
+		},
+		{
+			name:        "64-bit form for a short payload",
+			input:       buildFrame(true, 0x1, []byte("hi"), nil, 8),
+			wantOpcode:  0x1,
+			wantFin:     true,
+			wantLength:  2,
+			wantPayload: []byte("hi"),
+		},
+		{
+			name:        "masked",
+			input:       buildFrame(true, 0x1, []byte("masked payload"), mask, 0),
+			wantOpcode:  0x1,
+			wantFin:     true,
+			wantLength:  14,
+			wantPayload: []byte("masked payload"),
+		},
+		{
+			name:        "masked 16-bit length",
+			input:       buildFrame(true, 0x2, medium, mask, 0),
+			wantOpcode:  0x2,
+			wantFin:     true,
+			wantLength:  int64(len(medium)),
+			wantPayload: medium,
+		},
+		{
+			name:          "oversize frame is relayed but truncated",
+			limit:         10,
+			input:         buildFrame(true, 0x2, large, mask, 0),
+			wantOpcode:    0x2,
+			wantFin:       true,
+			wantLength:    int64(len(large)),
+			wantPayload:   large[:10],
+			wantTruncated: true,
+		},
+		{
+			name:    "huge announced length without data",
+			input:   hugeLength,
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "64-bit length with the top bit set",
+			input:   invalidLength,
+			wantErr: errWebSocketFrameLength,
+		},
+		{
+			name:    "oversize control frame",
+			input:   buildFrame(true, 0x9, medium, nil, 0),
+			wantErr: errWebSocketFrameLength,
+		},
+		{
+			name:    "truncated header",
+			input:   []byte{0x81, 126, 0x01},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewHTTPParser(tt.limit)
+			var relayed bytes.Buffer
+
+			frame, err := p.ReadWebSocketFrame(bufio.NewReader(bytes.NewReader(tt.input)), &relayed)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !bytes.Equal(relayed.Bytes(), tt.input) {
+				t.Errorf("relayed %d bytes, want the %d input bytes unchanged", relayed.Len(), len(tt.input))
+			}
+			if frame.Opcode != tt.wantOpcode || frame.Fin != tt.wantFin {
+				t.Errorf("opcode, fin = %d, %v, want %d, %v", frame.Opcode, frame.Fin, tt.wantOpcode, tt.wantFin)
+			}
+			if frame.Length != tt.wantLength {
+				t.Errorf("length = %d, want %d", frame.Length, tt.wantLength)
+			}
+			if !bytes.Equal(frame.Payload, tt.wantPayload) {
+				t.Errorf("payload = %q, want %q", truncate(frame.Payload), truncate(tt.wantPayload))
+			}
+			if frame.Truncated != tt.wantTruncated {
+				t.Errorf("truncated = %v, want %v", frame.Truncated, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestReadWebSocketFrameSequence(t *testing.T) {
+	p := NewHTTPParser(0)
+	input := append(buildFrame(false, 0x1, []byte("first "), nil, 0), buildFrame(true, 0x0, []byte("second"), nil, 0)...)
+	reader := bufio.NewReader(bytes.NewReader(input))
+
+	var payloads []string
+	for {
+		frame, err := p.ReadWebSocketFrame(reader, io.Discard)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		payloads = append(payloads, string(frame.Payload))
+	}
+
+	if len(payloads) != 2 || payloads[0] != "first " || payloads[1] != "second" {
+		t.Errorf("payloads = %q", payloads)
+	}
+}
+
+func truncate(b []byte) []byte {
+	if len(b) > 32 {
+		return b[:32]
+	}
+	return b
+}
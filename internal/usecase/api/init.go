@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"math"
+	"simple_proxy/internal/model"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 500
+)
+
+type Repository interface {
+	ListRequests(ctx context.Context, filter model.RequestFilter, offset, limit int64) ([]model.HTTPRequest, int64, error)
+	GetTransaction(ctx context.Context, requestID primitive.ObjectID) (*model.HTTPTransaction, error)
+	GetResponse(ctx context.Context, id primitive.ObjectID) (*model.HTTPResponse, error)
+	ListWebSocketMessages(ctx context.Context, requestID primitive.ObjectID) ([]model.WebSocketMessage, error)
+}
+
+type ApiService struct {
+	repository Repository
+}
+
+func NewApiService(repo Repository) *ApiService {
+	return &ApiService{
+		repository: repo,
+	}
+}
+
+func (a *ApiService) ListRequests(ctx context.Context, filter model.RequestFilter, page, limit int64) (*model.HTTPRequestPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	// Keeps (page-1)*limit and offset+limit from overflowing.
+	if page > math.MaxInt64/limit {
+		page = math.MaxInt64 / limit
+	}
+
+	requests, total, err := a.repository.ListRequests(ctx, filter, (page-1)*limit, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.HTTPRequestPage{
+		Requests: requests,
+		Total:    total,
+		Page:     page,
+		Limit:    limit,
+	}, nil
+}
+
+func (a *ApiService) GetTransaction(ctx context.Context, requestID string) (*model.HTTPTransaction, error) {
+	id, err := model.StringToObjectID(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.repository.GetTransaction(ctx, id)
+}
+
+func (a *ApiService) GetResponse(ctx context.Context, responseID string) (*model.HTTPResponse, error) {
+	id, err := model.StringToObjectID(responseID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.repository.GetResponse(ctx, id)
+}
+
+func (a *ApiService) ListWebSocketMessages(ctx context.Context, requestID string) ([]model.WebSocketMessage, error) {
+	id, err := model.StringToObjectID(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.repository.ListWebSocketMessages(ctx, id)
+}
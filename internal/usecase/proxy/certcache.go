@@ -0,0 +1,301 @@
+package proxy
+
+import (
+	"container/list"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// certExpiryMargin makes certificates that are about to expire count as
+// expired so clients never receive one that lapses mid-connection.
+const certExpiryMargin = time.Hour
+
+type certCacheEntry struct {
+	hostname string
+	cert     *tls.Certificate
+	expires  time.Time // zero unless cached for less than the leaf's validity
+}
+
+func (e *certCacheEntry) expired() bool {
+	return isExpired(e.cert) || !e.expires.IsZero() && time.Now().After(e.expires)
+}
+
+// certCache is a size-bounded LRU of minted leaf certificates. When dir is
+// set, certificates are also written there and picked up after a restart.
+type certCache struct {
+	mutex   sync.Mutex
+	size    int
+	dir     string
+	ca      *x509.Certificate
+	entries map[string]*list.Element
+	order   *list.List
+	stale   []string // files of removed entries, deleted once unlocked
+}
+
+func newCertCache(size int, dir string, ca *x509.Certificate) (*certCache, error) {
+	if dir != "" {
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create certificate cache directory %s: %w", dir, err)
+		}
+	}
+
+	cache := &certCache{
+		size:    max(size, 1),
+		dir:     dir,
+		ca:      ca,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+
+	if dir != "" {
+		cache.prune()
+	}
+
+	return cache, nil
+}
+
+func isExpired(cert *tls.Certificate) bool {
+	return cert.Leaf == nil || time.Now().Add(certExpiryMargin).After(cert.Leaf.NotAfter)
+}
+
+func (c *certCache) get(hostname string) (*tls.Certificate, bool) {
+	c.mutex.Lock()
+	if element, ok := c.entries[hostname]; ok {
+		entry := element.Value.(*certCacheEntry)
+		if !entry.expired() {
+			c.order.MoveToFront(element)
+			c.unlock()
+			return entry.cert, true
+		}
+
+		log.Printf("Cached certificate for %s expired", hostname)
+		c.remove(element)
+	}
+	c.unlock()
+
+	// The disk is read without holding the lock so handshakes for other hosts
+	// are not held up by it.
+	cert, ok := c.load(hostname)
+	if !ok {
+		return nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.unlock()
+
+	// Another handshake may have cached a certificate in the meantime.
+	if element, ok := c.entries[hostname]; ok {
+		entry := element.Value.(*certCacheEntry)
+		if !entry.expired() {
+			c.order.MoveToFront(element)
+			return entry.cert, true
+		}
+		c.remove(element)
+	}
+
+	c.add(&certCacheEntry{hostname: hostname, cert: cert})
+	return cert, true
+}
+
+func (c *certCache) put(hostname string, cert *tls.Certificate) {
+	c.mutex.Lock()
+	if element, ok := c.entries[hostname]; ok {
+		c.remove(element)
+	}
+	c.add(&certCacheEntry{hostname: hostname, cert: cert})
+	c.unlock()
+
+	if c.dir != "" {
+		err := c.store(hostname, cert)
+		if err != nil {
+			log.Printf("Error persisting certificate for %s: %v", hostname, err)
+		}
+	}
+}
+
+// putTemporary keeps cert in memory for ttl only and never persists it.
+func (c *certCache) putTemporary(hostname string, cert *tls.Certificate, ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.unlock()
+
+	if element, ok := c.entries[hostname]; ok {
+		c.remove(element)
+	}
+	c.add(&certCacheEntry{hostname: hostname, cert: cert, expires: time.Now().Add(ttl)})
+}
+
+func (c *certCache) add(entry *certCacheEntry) {
+	c.entries[entry.hostname] = c.order.PushFront(entry)
+
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops an entry from memory and schedules its persisted file for
+// deletion, so the directory stays bounded by the cache size.
+func (c *certCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*certCacheEntry)
+	delete(c.entries, entry.hostname)
+
+	if c.dir != "" && entry.expires.IsZero() {
+		c.stale = append(c.stale, c.path(entry.hostname))
+	}
+}
+
+// unlock releases the mutex, then deletes the files of entries removed
+// while it was held.
+func (c *certCache) unlock() {
+	stale := c.stale
+	c.stale = nil
+	c.mutex.Unlock()
+
+	for _, path := range stale {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error removing cached certificate %s: %v", path, err)
+		}
+	}
+}
+
+func (c *certCache) path(hostname string) string {
+	name := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, hostname)
+
+	return filepath.Join(c.dir, name+".pem")
+}
+
+// load reads a persisted certificate, discarding it when it expired or was
+// issued by a different CA. Distinct hostnames can share a file name, so a
+// certificate that does not cover hostname is a miss.
+func (c *certCache) load(hostname string) (*tls.Certificate, bool) {
+	if c.dir == "" {
+		return nil, false
+	}
+
+	path := c.path(hostname)
+	cert, err := c.read(path)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Discarding cached certificate %s: %v", path, err)
+			os.Remove(path)
+		}
+		return nil, false
+	}
+
+	if cert.Leaf.VerifyHostname(hostname) != nil {
+		return nil, false
+	}
+
+	log.Printf("Loaded persisted certificate for %s", hostname)
+	return cert, true
+}
+
+func (c *certCache) read(path string) (*tls.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(data, data)
+	if err == nil && cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+	}
+	if err == nil && cert.Leaf.CheckSignatureFrom(c.ca) != nil {
+		err = errors.New("issued by a different CA")
+	}
+	if err == nil && isExpired(&cert) {
+		err = errors.New("expired")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &cert, nil
+}
+
+// prune deletes persisted certificates that can no longer be served and,
+// beyond the cache size, the least recently written ones.
+func (c *certCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		log.Printf("Error reading certificate cache directory %s: %v", c.dir, err)
+		return
+	}
+
+	type persisted struct {
+		path    string
+		written time.Time
+	}
+	var kept []persisted
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".pem") {
+			continue
+		}
+		path := filepath.Join(c.dir, entry.Name())
+
+		info, err := entry.Info()
+		if err == nil {
+			_, err = c.read(path)
+		}
+		if err != nil {
+			log.Printf("Discarding cached certificate %s: %v", path, err)
+			os.Remove(path)
+			continue
+		}
+
+		kept = append(kept, persisted{path: path, written: info.ModTime()})
+	}
+
+	if len(kept) <= c.size {
+		return
+	}
+
+	slices.SortFunc(kept, func(a, b persisted) int {
+		return b.written.Compare(a.written)
+	})
+	for _, old := range kept[c.size:] {
+		os.Remove(old.path)
+	}
+	log.Printf("Removed %d persisted certificates beyond the cache size", len(kept)-c.size)
+}
+
+func (c *certCache) store(hostname string, cert *tls.Certificate) error {
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, der := range cert.Certificate {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	data = append(data, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyBytes})...)
+
+	path := c.path(hostname)
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
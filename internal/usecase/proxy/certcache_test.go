@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCA(t *testing.T) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return ca, key
+}
+
+func newTestLeaf(t *testing.T, ca *x509.Certificate, caKey *ecdsa.PrivateKey, hostname string, notAfter time.Time) *tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestCertCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	cache, err := newCertCache(2, "", ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := time.Now().Add(24 * time.Hour)
+	cache.put("a.example", newTestLeaf(t, ca, caKey, "a.example", valid))
+	cache.put("b.example", newTestLeaf(t, ca, caKey, "b.example", valid))
+
+	// Touching a makes b the least recently used entry.
+	if _, ok := cache.get("a.example"); !ok {
+		t.Fatal("a.example missing")
+	}
+	cache.put("c.example", newTestLeaf(t, ca, caKey, "c.example", valid))
+
+	if _, ok := cache.get("b.example"); ok {
+		t.Error("b.example was not evicted")
+	}
+	for _, hostname := range []string{"a.example", "c.example"} {
+		if _, ok := cache.get(hostname); !ok {
+			t.Errorf("%s was evicted", hostname)
+		}
+	}
+}
+
+func TestCertCacheDropsExpiringCertificates(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	cache, err := newCertCache(4, "", ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Within certExpiryMargin of NotAfter counts as expired.
+	cache.put("soon.example", newTestLeaf(t, ca, caKey, "soon.example", time.Now().Add(certExpiryMargin/2)))
+
+	if _, ok := cache.get("soon.example"); ok {
+		t.Error("certificate about to expire was served")
+	}
+	if cache.order.Len() != 0 {
+		t.Errorf("expired entry still cached, %d entries left", cache.order.Len())
+	}
+}
+
+func TestCertCachePersistence(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	dir := t.TempDir()
+
+	cache, err := newCertCache(4, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := newTestLeaf(t, ca, caKey, "persisted.example", time.Now().Add(24*time.Hour))
+	cache.put("persisted.example", cert)
+
+	restarted, err := newCertCache(4, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := restarted.get("persisted.example")
+	if !ok {
+		t.Fatal("persisted certificate was not loaded")
+	}
+	if !loaded.Leaf.Equal(cert.Leaf) {
+		t.Error("loaded certificate differs from the stored one")
+	}
+
+	otherCA, _ := newTestCA(t)
+	rotated, err := newCertCache(4, dir, otherCA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rotated.get("persisted.example"); ok {
+		t.Error("certificate issued by a different CA was loaded")
+	}
+}
+
+func countFiles(t *testing.T, dir string) int {
+	t.Helper()
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(files)
+}
+
+func TestCertCacheRemovesFilesOfEvictedEntries(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	dir := t.TempDir()
+	cache, err := newCertCache(1, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := time.Now().Add(24 * time.Hour)
+	cache.put("a.example", newTestLeaf(t, ca, caKey, "a.example", valid))
+	cache.put("b.example", newTestLeaf(t, ca, caKey, "b.example", valid))
+
+	if _, err := os.Stat(cache.path("a.example")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("file of the evicted a.example still exists: %v", err)
+	}
+	if n := countFiles(t, dir); n != 1 {
+		t.Errorf("%d files in the cache directory, want 1", n)
+	}
+
+	cache.put("soon.example", newTestLeaf(t, ca, caKey, "soon.example", time.Now().Add(certExpiryMargin/2)))
+	cache.get("soon.example")
+	if n := countFiles(t, dir); n != 0 {
+		t.Errorf("%d files left after the expired entry was dropped, want 0", n)
+	}
+}
+
+func TestCertCacheLoadChecksHostname(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	dir := t.TempDir()
+	cache, err := newCertCache(4, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both names are written to a_b.example.pem.
+	cache.put("a_b.example", newTestLeaf(t, ca, caKey, "a_b.example", time.Now().Add(24*time.Hour)))
+	if cache.path("a_b.example") != cache.path("a~b.example") {
+		t.Fatal("test hostnames do not share a file name")
+	}
+
+	restarted, err := newCertCache(4, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := restarted.get("a~b.example"); ok {
+		t.Error("certificate for a_b.example was served for a~b.example")
+	}
+	if _, ok := restarted.get("a_b.example"); !ok {
+		t.Error("certificate for a_b.example was not loaded")
+	}
+}
+
+func TestCertCachePrunesOnStartup(t *testing.T) {
+	ca, caKey := newTestCA(t)
+	dir := t.TempDir()
+	cache, err := newCertCache(8, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := time.Now().Add(24 * time.Hour)
+	for _, hostname := range []string{"a.example", "b.example", "c.example"} {
+		cache.put(hostname, newTestLeaf(t, ca, caKey, hostname, valid))
+	}
+	err = os.WriteFile(filepath.Join(dir, "broken.example.pem"), []byte("not a certificate"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = newCertCache(2, dir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countFiles(t, dir); n != 2 {
+		t.Errorf("%d files after pruning, want 2", n)
+	}
+}
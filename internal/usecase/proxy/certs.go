@@ -14,40 +14,67 @@ import (
 	"math/big"
 	"net"
 	"os"
+	"simple_proxy/internal/config"
+	"slices"
 	"strings"
-	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 const (
-	defaultCACertPath = "ca.crt"
-	defaultCAKeyPath  = "ca.key"
-	rsaBits           = 2048
-	certValidity      = 365 * 24 * time.Hour
+	rsaBits      = 2048
+	certValidity = 365 * 24 * time.Hour
+
+	// fallbackCertTTL is how long a certificate minted without the upstream
+	// one is reused before the upstream is tried again.
+	fallbackCertTTL = time.Minute
 )
 
 type CertManager struct {
 	caCert        *x509.Certificate
 	caPrivateKey  crypto.PrivateKey
-	hostCertCache map[string]*tls.Certificate
-	cacheMutex    sync.Mutex
+	dialTimeout   time.Duration
+	hostCertCache *certCache
+	inflight      singleflight.Group
+	keys          *keyPool
 }
 
-func NewCertManager(caCertPath, caKeyPath string) (*CertManager, error) {
+func NewCertManager(cfg config.TLSConfig, dialTimeout time.Duration) (*CertManager, error) {
+	keys, err := newKeyPool(cfg.LeafKey, cfg.KeyPoolSize)
+	if err != nil {
+		return nil, err
+	}
+
 	cm := &CertManager{
-		hostCertCache: make(map[string]*tls.Certificate),
+		dialTimeout: dialTimeout,
+		keys:        keys,
 	}
 
-	err := cm.loadOrGenerateCA(caCertPath, caKeyPath)
+	err = cm.loadOrGenerateCA(cfg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize CA: %w", err)
 	}
 
+	cm.hostCertCache, err = newCertCache(cfg.CertCacheSize, cfg.CertCacheDir, cm.caCert)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Println("CertManager initialized successfully.")
 	return cm, nil
 }
 
-func (cm *CertManager) loadOrGenerateCA(certPath, keyPath string) error {
+func (cm *CertManager) loadOrGenerateCA(cfg config.TLSConfig) error {
+	certPath, keyPath := cfg.CACert, cfg.CAKey
+
+	if !fileExists(certPath) && !fileExists(keyPath) {
+		err := generateCA(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to generate CA: %w", err)
+		}
+	}
+
 	certPEM, err := os.ReadFile(certPath)
 	if err != nil {
 		return fmt.Errorf("failed to read CA certificate file %s: %w", certPath, err)
@@ -78,42 +105,174 @@ func (cm *CertManager) loadOrGenerateCA(certPath, keyPath string) error {
 
 }
 
-func (cm *CertManager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-	hostname := hello.ServerName
-	if hostname == "" {
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func generateCA(cfg config.TLSConfig) error {
+	log.Printf("CA files %s and %s not found, generating a new CA %q", cfg.CACert, cfg.CAKey, cfg.CAName)
+
+	caPrivateKey, err := rsa.GenerateKey(rand.Reader, rsaBits)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA private key: %w", err)
+	}
+
+	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA serial number: %w", err)
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{cfg.CAName},
+			CommonName:   cfg.CAName,
+		},
+		NotBefore: now.Add(-1 * time.Hour),
+		NotAfter:  now.Add(cfg.CAValidity),
+
+		KeyUsage: x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+
+	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, caPrivateKey.Public(), caPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(caPrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode CA private key: %w", err)
+	}
+
+	err = writePEM(cfg.CAKey, "PRIVATE KEY", keyBytes, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = writePEM(cfg.CACert, "CERTIFICATE", derBytes, 0644)
+	if err != nil {
+		os.Remove(cfg.CAKey)
+		return err
+	}
 
-		return nil, errors.New("client did not provide SNI")
+	log.Printf("Generated new CA %s, install it on clients to trust intercepted connections", cfg.CACert)
+	return nil
+}
+
+// writePEM refuses to overwrite existing files so a CA is never replaced
+// behind the user's back.
+func writePEM(path, blockType string, der []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	err = pem.Encode(file, &pem.Block{Type: blockType, Bytes: der})
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+func (cm *CertManager) CACertificate() *x509.Certificate {
+	return cm.caCert
+}
+
+// CertificateFor returns a tls.Config.GetCertificate hook for a tunnel to
+// target. Clients without SNI get a certificate for the CONNECT host.
+func (cm *CertManager) CertificateFor(target string) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		return cm.getCertificate(hello.ServerName, target)
+	}
+}
+
+func (cm *CertManager) getCertificate(serverName, target string) (*tls.Certificate, error) {
+	hostname := serverName
+	if hostname == "" {
+		hostname = target
 	}
 
 	if strings.Contains(hostname, ":") {
-		var err error
-		hostname, _, err = net.SplitHostPort(hostname)
-		if err != nil {
-			return nil, fmt.Errorf("invalid SNI format: %s", hello.ServerName)
+		hostOnly, _, err := net.SplitHostPort(hostname)
+		if err == nil {
+			hostname = hostOnly
+		} else if net.ParseIP(hostname) == nil {
+			return nil, fmt.Errorf("invalid host format: %s", hostname)
 		}
 	}
 
-	cm.cacheMutex.Lock()
-	defer cm.cacheMutex.Unlock()
-
-	if cert, ok := cm.hostCertCache[hostname]; ok {
+	if cert, ok := cm.hostCertCache.get(hostname); ok {
 		log.Printf("Using cached certificate for %s", hostname)
 		return cert, nil
 	}
 
-	log.Printf("Generating new certificate for %s", hostname)
+	// Concurrent handshakes for the same host share one generation, other
+	// hosts are not blocked by it.
+	cert, err, _ := cm.inflight.Do(hostname, func() (any, error) {
+		if cert, ok := cm.hostCertCache.get(hostname); ok {
+			return cert, nil
+		}
+
+		upstream, err := cm.fetchUpstreamCert(target, serverName)
+		if err != nil {
+			log.Printf("Could not read upstream certificate of %s, minting a plain one for %s: %v", target, hostname, err)
+		}
+
+		log.Printf("Generating new certificate for %s", hostname)
+
+		hostCert, err := cm.generateHostCert(hostname, upstream)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate certificate for %s: %w", hostname, err)
+		}
+
+		if upstream == nil {
+			cm.hostCertCache.putTemporary(hostname, hostCert, fallbackCertTTL)
+		} else {
+			cm.hostCertCache.put(hostname, hostCert)
+		}
+
+		return hostCert, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cert.(*tls.Certificate), nil
+}
+
+// fetchUpstreamCert connects to the real server only to read its
+// certificate, so it is not verified here.
+func (cm *CertManager) fetchUpstreamCert(target, serverName string) (*x509.Certificate, error) {
+	dialer := &net.Dialer{Timeout: cm.dialTimeout}
 
-	hostCert, err := cm.generateHostCert(hostname)
+	conn, err := tls.DialWithDialer(dialer, "tcp", target, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate certificate for %s: %w", hostname, err)
+		return nil, err
+	}
+	defer conn.Close()
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate presented")
 	}
 
-	cm.hostCertCache[hostname] = hostCert
-	return hostCert, nil
+	return certs[0], nil
 }
 
-func (cm *CertManager) generateHostCert(hostname string) (*tls.Certificate, error) {
-	hostPrivateKey, err := rsa.GenerateKey(rand.Reader, rsaBits)
+func (cm *CertManager) generateHostCert(hostname string, upstream *x509.Certificate) (*tls.Certificate, error) {
+	hostPrivateKey, err := cm.keys.get()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate private key for %s: %w", hostname, err)
 	}
@@ -134,17 +293,31 @@ func (cm *CertManager) generateHostCert(hostname string) (*tls.Certificate, erro
 		NotBefore: now.Add(-1 * time.Minute),
 		NotAfter:  now.Add(certValidity),
 
-		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
+		KeyUsage:    x509.KeyUsageDigitalSignature,
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 
 		BasicConstraintsValid: false,
 		IsCA:                  false,
+	}
 
-		DNSNames: []string{hostname},
+	if _, ok := hostPrivateKey.(*rsa.PrivateKey); ok {
+		template.KeyUsage |= x509.KeyUsageKeyEncipherment
 	}
 
-	if ip := net.ParseIP(hostname); ip != nil {
-		template.IPAddresses = append(template.IPAddresses, ip)
+	if upstream != nil {
+		template.Subject = upstream.Subject
+		template.DNSNames = slices.Clone(upstream.DNSNames)
+		template.IPAddresses = slices.Clone(upstream.IPAddresses)
+	}
+
+	// The requested host must be covered even when the upstream certificate
+	// does not list it.
+	if upstream == nil || upstream.VerifyHostname(hostname) != nil {
+		if ip := net.ParseIP(hostname); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, hostname)
+		}
 	}
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, &template, cm.caCert, hostPrivateKey.Public(), cm.caPrivateKey)
@@ -152,10 +325,15 @@ func (cm *CertManager) generateHostCert(hostname string) (*tls.Certificate, erro
 		return nil, fmt.Errorf("failed to create certificate for %s: %w", hostname, err)
 	}
 
+	leaf, err := x509.ParseCertificate(derBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate for %s: %w", hostname, err)
+	}
+
 	tlsCert := &tls.Certificate{
 		Certificate: [][]byte{derBytes},
 		PrivateKey:  hostPrivateKey,
-		Leaf:        &template,
+		Leaf:        leaf,
 	}
 
 	return tlsCert, nil
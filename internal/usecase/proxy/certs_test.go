@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestCertManager(t *testing.T, cacheDir string) *CertManager {
+	t.Helper()
+
+	ca, caKey := newTestCA(t)
+	keys, err := newKeyPool(leafKeyECDSA, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache, err := newCertCache(16, cacheDir, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &CertManager{
+		caCert:        ca,
+		caPrivateKey:  caKey,
+		dialTimeout:   time.Second,
+		hostCertCache: cache,
+		keys:          keys,
+	}
+}
+
+func TestGenerateHostCertMirrorsUpstream(t *testing.T) {
+	cm := newTestCertManager(t, "")
+	upstream := &x509.Certificate{
+		Subject: pkix.Name{
+			Organization: []string{"Example Corp"},
+			Country:      []string{"SE"},
+			CommonName:   "www.example.com",
+		},
+		DNSNames:    []string{"www.example.com", "*.cdn.example.com"},
+		IPAddresses: []net.IP{net.ParseIP("192.0.2.10")},
+	}
+
+	tests := []struct {
+		name     string
+		hostname string
+		upstream *x509.Certificate
+		wantDNS  []string
+		wantIPs  []string
+		wantOrg  string
+		wantCN   string
+	}{
+		{
+			name:     "covered name",
+			hostname: "img.cdn.example.com",
+			upstream: upstream,
+			wantDNS:  []string{"www.example.com", "*.cdn.example.com"},
+			wantIPs:  []string{"192.0.2.10"},
+			wantOrg:  "Example Corp",
+			wantCN:   "www.example.com",
+		},
+		{
+			name:     "uncovered name is appended",
+			hostname: "api.example.com",
+			upstream: upstream,
+			wantDNS:  []string{"www.example.com", "*.cdn.example.com", "api.example.com"},
+			wantIPs:  []string{"192.0.2.10"},
+			wantOrg:  "Example Corp",
+			wantCN:   "www.example.com",
+		},
+		{
+			name:     "uncovered IP is appended",
+			hostname: "198.51.100.7",
+			upstream: upstream,
+			wantDNS:  []string{"www.example.com", "*.cdn.example.com"},
+			wantIPs:  []string{"192.0.2.10", "198.51.100.7"},
+			wantOrg:  "Example Corp",
+			wantCN:   "www.example.com",
+		},
+		{
+			name:     "no upstream certificate",
+			hostname: "plain.example",
+			wantDNS:  []string{"plain.example"},
+			wantOrg:  "KGI",
+			wantCN:   "plain.example",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, err := cm.generateHostCert(tt.hostname, tt.upstream)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf := cert.Leaf
+
+			if !slices.Equal(leaf.DNSNames, tt.wantDNS) {
+				t.Errorf("DNSNames = %q, want %q", leaf.DNSNames, tt.wantDNS)
+			}
+			var ips []string
+			for _, ip := range leaf.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			if !slices.Equal(ips, tt.wantIPs) {
+				t.Errorf("IPAddresses = %q, want %q", ips, tt.wantIPs)
+			}
+			if leaf.Subject.CommonName != tt.wantCN || !slices.Equal(leaf.Subject.Organization, []string{tt.wantOrg}) {
+				t.Errorf("Subject = %v, want CN %q O %q", leaf.Subject, tt.wantCN, tt.wantOrg)
+			}
+			if err := leaf.VerifyHostname(tt.hostname); err != nil {
+				t.Errorf("leaf does not cover %s: %v", tt.hostname, err)
+			}
+			if err := leaf.CheckSignatureFrom(cm.caCert); err != nil {
+				t.Errorf("leaf not signed by the CA: %v", err)
+			}
+		})
+	}
+}
+
+func TestFallbackCertificateIsNotKept(t *testing.T) {
+	dir := t.TempDir()
+	cm := newTestCertManager(t, dir)
+
+	// Nothing listens on the target, so the upstream certificate cannot be
+	// read and a plain one is minted.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := listener.Addr().String()
+	listener.Close()
+
+	cert, err := cm.getCertificate("down.example", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cert.Leaf.VerifyHostname("down.example"); err != nil {
+		t.Errorf("fallback leaf does not cover the host: %v", err)
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 0 {
+		t.Errorf("fallback certificate was persisted: %v", files)
+	}
+
+	cached, ok := cm.hostCertCache.get("down.example")
+	if !ok || cached != cert {
+		t.Fatal("fallback certificate is not reused within its TTL")
+	}
+
+	cm.hostCertCache.entries["down.example"].Value.(*certCacheEntry).expires = time.Now().Add(-time.Second)
+	if _, ok := cm.hostCertCache.get("down.example"); ok {
+		t.Error("fallback certificate is still served after its TTL")
+	}
+}
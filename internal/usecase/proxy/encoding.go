@@ -0,0 +1,37 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+const (
+	responseEncodingPreserve = "preserve"
+	responseEncodingDecode   = "decode"
+	responseEncodingReencode = "reencode"
+)
+
+func validateResponseEncoding(mode string) error {
+	switch mode {
+	case responseEncodingPreserve, responseEncodingDecode, responseEncodingReencode:
+		return nil
+	default:
+		return fmt.Errorf("unsupported response encoding %q", mode)
+	}
+}
+
+// prepareResponseBody applies the configured response encoding before resp
+// is sent to the client. Stored bodies are decoded by the parser regardless.
+func (h *HttpProxyService) prepareResponseBody(resp *http.Response) {
+	switch h.responseEncoding {
+	case responseEncodingDecode:
+		h.parser.DecodeResponseBody(resp)
+	case responseEncodingReencode:
+		encodings := h.parser.DecodeResponseBody(resp)
+		err := h.parser.EncodeResponseBody(resp, encodings)
+		if err != nil {
+			log.Printf("Error re-encoding response: %v\n", err)
+		}
+	}
+}
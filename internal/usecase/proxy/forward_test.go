@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"simple_proxy/internal/model"
+	"simple_proxy/internal/repository/memory"
+	"strings"
+	"testing"
+)
+
+func TestSendRequestStoresRequestBeforeResponse(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewHTTPRepository()
+	h := newTestService(repo)
+
+	var storedEarly int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, storedEarly, _ = repo.ListRequests(ctx, model.RequestFilter{}, 0, 10)
+		io.ReadAll(r.Body)
+		w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	r := httptest.NewRequest(http.MethodPost, upstream.URL+"/upload", strings.NewReader("payload"))
+	parsedRequest, capture := h.parser.ParseRequest(r)
+
+	resp, _, err := h.sendRequest(ctx, r, parsedRequest, capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	capture.Wait()
+
+	if storedEarly != 1 {
+		t.Errorf("request was not stored before upstream answered")
+	}
+
+	stored, err := repo.GetRequest(ctx, parsedRequest.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stored.Body) != "payload" || stored.BodySize != 7 || stored.BodyTruncated {
+		t.Errorf("stored body %q, size %d, truncated %v", stored.Body, stored.BodySize, stored.BodyTruncated)
+	}
+}
@@ -3,227 +3,411 @@ package proxy
 import (
 	"bufio"
 	"context"
-	"crypto/rand"
 	"crypto/tls"
-	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
-	"net/url"
-	"os"
+	"simple_proxy/internal/config"
 	"simple_proxy/internal/model"
-	"simple_proxy/internal/repository/mongo"
+	"simple_proxy/internal/service/miner"
 	"simple_proxy/internal/service/parser"
 	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/net/http2"
 )
 
+var (
+	errCreateRequest  = errors.New("error creating request")
+	errForwardRequest = errors.New("error forwarding request")
+)
+
+type Repository interface {
+	SaveRequest(ctx context.Context, request *model.HTTPRequest) error
+	SaveResponse(ctx context.Context, response *model.HTTPResponse) error
+	UpdateRequestBody(ctx context.Context, request *model.HTTPRequest) error
+	GetRequest(ctx context.Context, id primitive.ObjectID) (*model.HTTPRequest, error)
+	UpdateTunnelStats(ctx context.Context, requestID primitive.ObjectID, stats *model.TunnelStats) error
+	SaveScanJob(ctx context.Context, job *model.ScanJob) error
+	UpdateScanJob(ctx context.Context, job *model.ScanJob) error
+	GetScanJob(ctx context.Context, id primitive.ObjectID) (*model.ScanJob, error)
+	SaveWebSocketMessage(ctx context.Context, message *model.WebSocketMessage) error
+}
+
 type HttpProxyService struct {
-	certManager *CertManager
-	parser      *parser.HTTPParser
-	repository  *mongo.HTTPRepository
-	params      []string // List of parameters to test
+	certManager      *CertManager
+	parser           *parser.HTTPParser
+	repository       Repository
+	transport        *http.Transport
+	client           *http.Client
+	miner            *miner.ParamMiner
+	minerEnabled     bool
+	passthrough      *passthroughList
+	responseEncoding string
+	bodyLimit        int64
 }
 
-func loadParams(filePath string) ([]string, error) {
-	file, err := os.Open(filePath)
+func NewHttpProxyService(repo Repository, cfg *config.Config) *HttpProxyService {
+	cm, err := NewCertManager(cfg.TLS, cfg.Upstream.DialTimeout)
 	if err != nil {
-		return nil, err
+		log.Fatalf("FATAL: Failed to initialize certificate manager: %v", err)
+	}
+
+	passthrough, err := newPassthroughList(cfg.TLS)
+	if err != nil {
+		log.Fatalf("FATAL: Failed to load passthrough rules: %v", err)
+	}
+
+	err = validateResponseEncoding(cfg.Proxy.ResponseEncoding)
+	if err != nil {
+		log.Fatalf("FATAL: Invalid proxy configuration: %v", err)
 	}
-	defer file.Close()
+
+	httpParser := parser.NewHTTPParser(cfg.Storage.BodyLimit)
 
 	var params []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		param := strings.TrimSpace(scanner.Text())
-		if param != "" {
-			params = append(params, param)
+	if cfg.Miner.Enabled {
+		params, err = miner.LoadParams(cfg.Miner.Wordlist)
+		if err != nil {
+			log.Printf("WARNING: Failed to load parameters from %s: %v", cfg.Miner.Wordlist, err)
+			params = []string{}
 		}
+
+		log.Printf("Loaded %d parameters from %s", len(params), cfg.Miner.Wordlist)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	transport := newUpstreamTransport(cfg.Upstream)
+	client := newUpstreamClient(transport, cfg.Upstream.Timeout)
+	thresholds := miner.Thresholds{
+		Baselines:   cfg.Miner.Baselines,
+		LengthDelta: cfg.Miner.LengthDelta,
+		WordDelta:   cfg.Miner.WordDelta,
 	}
 
-	return params, nil
+	return &HttpProxyService{
+		certManager:      cm,
+		parser:           httpParser,
+		repository:       repo,
+		transport:        transport,
+		client:           client,
+		miner:            miner.NewParamMiner(client, params, thresholds),
+		minerEnabled:     cfg.Miner.Enabled,
+		passthrough:      passthrough,
+		responseEncoding: cfg.Proxy.ResponseEncoding,
+		bodyLimit:        cfg.Storage.BodyLimit,
+	}
 }
 
-func generateRandomValue(length int) string {
-	bytes := make([]byte, length)
-	_, err := rand.Read(bytes)
-	if err != nil {
-		return "randomvalue123456789"
-	}
-	return hex.EncodeToString(bytes)
+func (h *HttpProxyService) CACertificate() []byte {
+	return h.certManager.CACertificate().Raw
 }
 
-func isParameterReflected(paramName string, responseBody string) bool {
-	return strings.Contains(responseBody, paramName)
+func (h *HttpProxyService) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
+	ctx := context.Background()
+
+	if isWebSocketUpgrade(r) {
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
+			return
+		}
+
+		clientConn, bufrw, err := hijacker.Hijack()
+		if err != nil {
+			http.Error(w, "Failed to hijack connection", http.StatusInternalServerError)
+			return
+		}
+		defer clientConn.Close()
+
+		h.handleWebSocket(ctx, clientConn, bufrw.Reader, r)
+		return
+	}
+
+	h.serveRequest(ctx, w, r)
 }
 
-func NewHttpProxyService(mongoURI, mongoDB string) *HttpProxyService {
-	cm, err := NewCertManager(defaultCACertPath, defaultCAKeyPath)
+func (h *HttpProxyService) serveRequest(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	resp, err := h.forwardRequest(ctx, r)
 	if err != nil {
-		log.Fatalf("FATAL: Failed to initialize certificate manager: %v", err)
+		log.Printf("%v\n", err)
+		http.Error(w, http.StatusText(statusForError(err)), statusForError(err))
+		return
 	}
+	defer resp.Body.Close()
+
+	copyEndToEndHeaders(w.Header(), resp.Header)
 
-	httpParser := parser.NewHTTPParser()
+	w.WriteHeader(resp.StatusCode)
 
-	repo, err := mongo.NewHTTPRepository(mongoURI, mongoDB)
+	_, err = io.Copy(flushWriter{w}, resp.Body)
 	if err != nil {
-		log.Fatalf("FATAL: Failed to initialize MongoDB repository: %v", err)
+		log.Printf("Error copying response body to client: %v\n", err)
 	}
+}
 
-	params, err := loadParams("params.txt")
-	if err != nil {
-		log.Printf("WARNING: Failed to load parameters from params.txt: %v", err)
-		params = []string{}
+// hopByHopHeaders only apply to a single connection and must not be
+// forwarded; HTTP/2 clients reject responses that carry them.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// copyEndToEndHeaders copies src into dst without hop-by-hop headers,
+// including any header named in Connection.
+func copyEndToEndHeaders(dst, src http.Header) {
+	skip := make(map[string]bool, len(hopByHopHeaders))
+	for _, name := range hopByHopHeaders {
+		skip[name] = true
+	}
+	for _, value := range src.Values("Connection") {
+		for _, name := range strings.Split(value, ",") {
+			skip[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+		}
 	}
 
-	log.Printf("Loaded %d parameters from params.txt", len(params))
+	for key, values := range src {
+		if !skip[http.CanonicalHeaderKey(key)] {
+			dst[key] = values
+		}
+	}
+}
 
-	return &HttpProxyService{
-		certManager: cm,
-		parser:      httpParser,
-		repository:  repo,
-		params:      params,
+// flushWriter pushes every chunk to the client as soon as it arrives from
+// upstream instead of waiting for the response writer's buffer to fill.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
 	}
+	return n, err
 }
 
-func (h *HttpProxyService) HandleHTTPRequest(w http.ResponseWriter, r *http.Request) {
-	ctx := context.Background()
+func (h *HttpProxyService) forwardRequest(ctx context.Context, r *http.Request) (*http.Response, error) {
+	parsedRequest, capture := h.parser.ParseRequest(r)
+
+	resp, _, err := h.sendRequest(ctx, r, parsedRequest, capture)
+	return resp, err
+}
+
+// sendRequest forwards r and returns the upstream response with its body
+// still unread. The request is stored before it is sent and its body added
+// once the transport has read or closed it; the response is stored once its
+// body has been read to the end or closed.
+func (h *HttpProxyService) sendRequest(ctx context.Context, r *http.Request, parsedRequest *model.HTTPRequest, capture *parser.BodyCapture) (*http.Response, *model.HTTPResponse, error) {
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+
+	h.parser.ModifyRequestForGzip(r)
+
+	targetURL := r.URL.String()
+	log.Printf("Forwarding request to %s\n", targetURL)
 
-	parsedRequest, bodyBytes, err := h.parser.ParseRequest(r)
+	req, err := http.NewRequestWithContext(ctx, r.Method, targetURL, r.Body)
 	if err != nil {
-		log.Printf("Error parsing request: %v\n", err)
-		http.Error(w, "Error parsing request", http.StatusInternalServerError)
-		return
+		return nil, nil, fmt.Errorf("%w for %s: %v", errCreateRequest, targetURL, err)
 	}
 
+	req.Header = r.Header
+	req.Host = r.Host
+	req.ContentLength = r.ContentLength
+
 	err = h.repository.SaveRequest(ctx, parsedRequest)
 	if err != nil {
-		log.Printf("Error saving request to MongoDB: %v\n", err)
+		log.Printf("Error saving request: %v\n", err)
+	} else {
+		// Upstream may answer before the whole body was sent, and the client
+		// may be gone by the time the transport is done with it.
+		updateCtx := context.WithoutCancel(ctx)
+		capture.OnFinish(func() {
+			err := h.repository.UpdateRequestBody(updateCtx, parsedRequest)
+			if err != nil {
+				log.Printf("Error saving request body: %v\n", err)
+			}
+		})
 	}
 
-	r.RequestURI = ""
-	r.Header.Del("Proxy-Connection")
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w to %s: %v", errForwardRequest, targetURL, err)
+	}
 
-	h.parser.ModifyRequestForGzip(r, bodyBytes)
+	log.Printf("Received response from %s: %d\n", targetURL, resp.StatusCode)
 
-	targetURL := r.URL.String()
-	log.Printf("Forwarding request to %s\n", targetURL)
+	parsedResponse, err := h.parser.ParseResponse(resp, parsedRequest.ID.Hex(), func(res *model.HTTPResponse) {
+		err := h.repository.SaveResponse(ctx, res)
+		if err != nil {
+			log.Printf("Error saving response: %v\n", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Error parsing response: %v\n", err)
+	}
+
+	h.prepareResponseBody(resp)
+
+	return resp, parsedResponse, nil
+}
 
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+func (h *HttpProxyService) Repeat(ctx context.Context, requestID string) (*model.HTTPTransaction, error) {
+	id, err := model.StringToObjectID(requestID)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(h.params) > 0 {
-		originalURL := r.URL.String()
-		baseURL := r.URL.Scheme + "://" + r.URL.Host + r.URL.Path
+	original, err := h.repository.GetRequest(ctx, id)
+	if err != nil {
+		return nil, err
+	}
 
-		for _, param := range h.params {
-			randomValue := generateRandomValue(16)
+	if original.Method == http.MethodConnect {
+		return nil, fmt.Errorf("%w: CONNECT requests cannot be repeated", model.ErrUnsupported)
+	}
+	if original.BodyTruncated {
+		return nil, fmt.Errorf("%w: request body was truncated when stored", model.ErrUnsupported)
+	}
 
-			paramURL := baseURL
-			if strings.Contains(baseURL, "?") {
-				paramURL += "&" + param + "=" + randomValue
-			} else {
-				paramURL += "?" + param + "=" + randomValue
-			}
+	r, err := h.parser.BuildRequest(original)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errCreateRequest, err)
+	}
 
-			log.Printf("Testing parameter %s with URL: %s\n", param, paramURL)
+	parsedRequest, capture := h.parser.ParseRequest(r)
+	parsedRequest.OriginalRequestID = original.ID
 
-			paramReq, err := http.NewRequest(r.Method, paramURL, nil)
-			if err != nil {
-				log.Printf("Error creating param-miner request for %s: %v\n", paramURL, err)
-				continue
-			}
+	log.Printf("Repeating request %s\n", original.ID.Hex())
 
-			for key, values := range r.Header {
-				for _, value := range values {
-					paramReq.Header.Add(key, value)
-				}
-			}
-			paramReq.Host = r.Host
+	resp, parsedResponse, err := h.sendRequest(ctx, r, parsedRequest, capture)
+	if err != nil {
+		return nil, err
+	}
 
-			paramResp, err := client.Do(paramReq)
-			if err != nil {
-				log.Printf("Error performing param-miner request to %s: %v\n", paramURL, err)
-				continue
-			}
+	// Reading the body to the end stores the complete response.
+	_, err = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errForwardRequest, err)
+	}
+	capture.Wait()
 
-			paramRespBody, err := io.ReadAll(paramResp.Body)
-			paramResp.Body.Close()
-			if err != nil {
-				log.Printf("Error reading param-miner response body: %v\n", err)
-				continue
-			}
+	return &model.HTTPTransaction{
+		Request:  *parsedRequest,
+		Response: parsedResponse,
+	}, nil
+}
 
-			responseBodyStr := string(paramRespBody)
-			if isParameterReflected(param, responseBodyStr) {
-				log.Printf("FOUND REFLECTED PARAMETER: %s\n", param)
-				log.Printf("Hidden parameter value: %s\n", randomValue)
-			}
-		}
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, errForwardRequest):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
 
-		parsedURL, _ := url.Parse(originalURL)
-		r.URL = parsedURL
+func (h *HttpProxyService) StartScan(ctx context.Context, requestID, location string) (*model.ScanJob, error) {
+	if !h.minerEnabled {
+		return nil, fmt.Errorf("%w: param mining is disabled", model.ErrUnsupported)
 	}
 
-	req, err := http.NewRequest(r.Method, targetURL, r.Body)
+	id, err := model.StringToObjectID(requestID)
 	if err != nil {
-		log.Printf("Error creating new request for %s: %v\n", targetURL, err)
-		http.Error(w, "Error creating request", http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	req.Header = r.Header
-	req.Host = r.Host
+	paramLocation, err := model.ParseParamLocation(location)
+	if err != nil {
+		return nil, err
+	}
 
-	resp, err := client.Do(req)
+	request, err := h.repository.GetRequest(ctx, id)
 	if err != nil {
-		log.Printf("Error performing request to %s: %v\n", targetURL, err)
-		http.Error(w, "Error forwarding request", http.StatusServiceUnavailable)
-		return
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	log.Printf("Received response from %s: %d\n", targetURL, resp.StatusCode)
+	if request.Method == http.MethodConnect {
+		return nil, fmt.Errorf("%w: CONNECT requests cannot be scanned", model.ErrUnsupported)
+	}
+	if request.BodyTruncated {
+		return nil, fmt.Errorf("%w: request body was truncated when stored", model.ErrUnsupported)
+	}
 
-	parsedResponse, respBodyBytes, err := h.parser.ParseResponse(resp, parsedRequest.ID.Hex())
+	job := &model.ScanJob{
+		RequestID: request.ID,
+		Location:  paramLocation,
+		Status:    model.ScanPending,
+		Findings:  []model.ParamFinding{},
+	}
+
+	err = h.repository.SaveScanJob(ctx, job)
 	if err != nil {
-		log.Printf("Error parsing response: %v\n", err)
-	} else {
-		err = h.repository.SaveResponse(ctx, parsedResponse)
-		if err != nil {
-			log.Printf("Error saving response to MongoDB: %v\n", err)
-		}
+		return nil, err
 	}
 
-	h.parser.ModifyResponseForGzip(resp, respBodyBytes)
+	log.Printf("Starting %s param-miner scan %s for request %s\n", paramLocation, job.ID.Hex(), request.ID.Hex())
+
+	jobCopy := *job
+	go h.runScan(&jobCopy, request)
 
-	for key, values := range resp.Header {
-		w.Header()[key] = values
+	return job, nil
+}
+
+func (h *HttpProxyService) runScan(job *model.ScanJob, request *model.HTTPRequest) {
+	ctx := context.Background()
+
+	job.Status = model.ScanRunning
+	err := h.repository.UpdateScanJob(ctx, job)
+	if err != nil {
+		log.Printf("Error updating scan %s: %v\n", job.ID.Hex(), err)
 	}
 
-	w.WriteHeader(resp.StatusCode)
+	result, err := h.miner.Mine(ctx, request, job.Location)
 
-	_, err = io.Copy(w, resp.Body)
+	job.Findings = result.Findings
+	job.Tested = result.Tested
+	job.Requests = result.Requests
+	job.FinishedAt = time.Now()
+	job.Status = model.ScanDone
 	if err != nil {
-		log.Printf("Error copying response body to client: %v\n", err)
+		job.Status = model.ScanFailed
+		job.Error = err.Error()
+	}
+
+	log.Printf("Param-miner scan %s finished: %d params tested in %d requests, %d found\n", job.ID.Hex(), result.Tested, result.Requests, len(result.Findings))
+
+	err = h.repository.UpdateScanJob(ctx, job)
+	if err != nil {
+		log.Printf("Error updating scan %s: %v\n", job.ID.Hex(), err)
+	}
+}
+
+func (h *HttpProxyService) GetScan(ctx context.Context, jobID string) (*model.ScanJob, error) {
+	id, err := model.StringToObjectID(jobID)
+	if err != nil {
+		return nil, err
 	}
+
+	return h.repository.GetScanJob(ctx, id)
 }
 
 func (h *HttpProxyService) HandleConnect(w http.ResponseWriter, r *http.Request) {
 	ctx := context.Background()
 
-	reqID := primitive.NewObjectID()
 	connectRequest := &model.HTTPRequest{
-		ID:          reqID,
 		Method:      r.Method,
 		Path:        r.URL.Path,
 		TargetHost:  r.Host,
@@ -243,7 +427,7 @@ func (h *HttpProxyService) HandleConnect(w http.ResponseWriter, r *http.Request)
 
 	err := h.repository.SaveRequest(ctx, connectRequest)
 	if err != nil {
-		log.Printf("Error saving CONNECT request to MongoDB: %v\n", err)
+		log.Printf("Error saving CONNECT request: %v\n", err)
 	}
 
 	log.Printf("Handling CONNECT request for %s from %s\n", r.Host, r.RemoteAddr)
@@ -266,75 +450,163 @@ func (h *HttpProxyService) HandleConnect(w http.ResponseWriter, r *http.Request)
 		log.Printf("Failed to send 200 OK to client %s: %v\n", clientConn.RemoteAddr(), err)
 		return
 	}
-	log.Printf("Sent 200 OK for %s. Proceeding with MITM TLS handshake...\n", r.Host)
+	log.Printf("Sent 200 OK for %s\n", r.Host)
 
+	body := []byte("Connection established")
 	connectResponse := &model.HTTPResponse{
-		RequestID:     reqID,
+		RequestID:     connectRequest.ID,
 		StatusCode:    200,
 		Headers:       make(map[string][]string),
-		Body:          "Connection established",
+		Body:          body,
+		BodySize:      int64(len(body)),
+		Charset:       "utf-8",
 		ContentType:   "text/plain",
-		ContentLength: 22,
+		ContentLength: int64(len(body)),
 	}
 
 	err = h.repository.SaveResponse(ctx, connectResponse)
 	if err != nil {
-		log.Printf("Error saving CONNECT response to MongoDB: %v\n", err)
+		log.Printf("Error saving CONNECT response: %v\n", err)
+	}
+
+	reader := bufio.NewReader(clientConn)
+	stats := &model.TunnelStats{}
+
+	if reason, ok := h.passthrough.match(r.Host); ok {
+		stats.Mode = model.TunnelPassthrough
+		log.Printf("Passing tunnel to %s through without interception: %s\n", r.Host, reason)
+	} else {
+		stats.Mode = detectTunnelMode(clientConn, reader)
+		log.Printf("Tunnel to %s carries %s traffic\n", r.Host, stats.Mode)
+	}
+
+	switch stats.Mode {
+	case model.TunnelRaw, model.TunnelPassthrough:
+		stats.BytesSent, stats.BytesReceived = h.relayTunnel(ctx, clientConn, reader, r.Host)
+	case model.TunnelHTTP:
+		h.interceptHTTP(ctx, clientConn, reader, "http", r.Host)
+	default:
+		h.interceptTLS(ctx, &bufferedConn{Conn: clientConn, reader: reader}, r.Host)
+	}
+
+	stats.ClosedAt = time.Now()
+	err = h.repository.UpdateTunnelStats(ctx, connectRequest.ID, stats)
+	if err != nil {
+		log.Printf("Error saving tunnel stats for %s: %v\n", r.Host, err)
 	}
+}
 
+func (h *HttpProxyService) interceptTLS(ctx context.Context, clientConn net.Conn, targetHost string) {
 	tlsConfig := &tls.Config{
-		GetCertificate: h.certManager.GetCertificate,
+		GetCertificate: h.certManager.CertificateFor(targetHost),
 		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{http2.NextProtoTLS, "http/1.1"},
 	}
 
 	tlsClientConn := tls.Server(clientConn, tlsConfig)
-	err = tlsClientConn.Handshake()
+	err := tlsClientConn.Handshake()
 	if err != nil {
-		log.Printf("TLS handshake with client %s (for %s) failed: %v\n", clientConn.RemoteAddr(), r.Host, err)
+		log.Printf("TLS handshake with client %s (for %s) failed: %v\n", clientConn.RemoteAddr(), targetHost, err)
+		h.passthrough.recordFailure(targetHost)
 		return
 	}
+	h.passthrough.recordSuccess(targetHost)
 	log.Printf("TLS handshake with client %s successful.\n", clientConn.RemoteAddr())
 	defer tlsClientConn.Close()
 
-	targetHost := r.Host
-	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second}
-
-	destTLSConfig := &tls.Config{
-		ServerName: tlsClientConn.ConnectionState().ServerName,
+	if tlsClientConn.ConnectionState().NegotiatedProtocol == http2.NextProtoTLS {
+		h.interceptHTTP2(ctx, tlsClientConn, targetHost)
+		return
 	}
-	if destTLSConfig.ServerName == "" {
-		hostOnly, _, _ := net.SplitHostPort(targetHost)
-		destTLSConfig.ServerName = hostOnly
+
+	h.interceptHTTP(ctx, tlsClientConn, bufio.NewReader(tlsClientConn), "https", targetHost)
+}
+
+// interceptHTTP2 serves the decrypted HTTP/2 connection; every stream is
+// handled on its own and recorded as a separate request/response pair.
+func (h *HttpProxyService) interceptHTTP2(ctx context.Context, conn *tls.Conn, targetHost string) {
+	server := &http2.Server{}
+
+	server.ServeConn(conn, &http2.ServeConnOpts{
+		Context: ctx,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.URL.Scheme = "https"
+			r.URL.Host = targetHost
+			r.RemoteAddr = conn.RemoteAddr().String()
+
+			h.serveRequest(r.Context(), w, r)
+		}),
+	})
+}
+
+// interceptHTTP reads HTTP/1.1 requests from a tunnel, keeping the
+// connection alive for as long as the client and upstream allow.
+func (h *HttpProxyService) interceptHTTP(ctx context.Context, conn net.Conn, reader *bufio.Reader, scheme, targetHost string) {
+	for {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !strings.Contains(err.Error(), "use of closed network connection") {
+				log.Printf("Error reading request from tunnel to %s: %v\n", targetHost, err)
+			}
+			return
+		}
+
+		req.URL.Scheme = scheme
+		req.URL.Host = targetHost
+		req.RemoteAddr = conn.RemoteAddr().String()
+
+		if isWebSocketUpgrade(req) {
+			h.handleWebSocket(ctx, conn, reader, req)
+			return
+		}
+
+		resp, err := h.forwardRequest(ctx, req)
+		if err != nil {
+			log.Printf("%v\n", err)
+			writeTunnelError(conn, statusForError(err))
+			return
+		}
+
+		// The client speaks HTTP/1.1 whatever was negotiated upstream, and a
+		// streamed body of unknown length is chunked to keep the tunnel open.
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = "HTTP/1.1", 1, 1
+		if resp.ContentLength < 0 && req.ProtoAtLeast(1, 1) {
+			resp.TransferEncoding = []string{"chunked"}
+		}
+		header := make(http.Header, len(resp.Header))
+		copyEndToEndHeaders(header, resp.Header)
+		resp.Header = header
+
+		err = resp.Write(conn)
+		resp.Body.Close()
+		if err != nil {
+			log.Printf("Error writing response to tunnel for %s: %v\n", targetHost, err)
+			return
+		}
+
+		if req.Close || resp.Close || !hasKnownLength(resp) {
+			return
+		}
 	}
+}
 
-	destTLSConn, err := tls.DialWithDialer(dialer, "tcp", targetHost, destTLSConfig)
-	if err != nil {
-		log.Printf("Failed to establish TLS connection to destination %s: %v\n", targetHost, err)
-		return
+func hasKnownLength(resp *http.Response) bool {
+	if resp.ContentLength >= 0 {
+		return true
 	}
-	log.Printf("TLS connection to destination %s established.\n", targetHost)
-	defer destTLSConn.Close()
 
-	errChan := make(chan error, 2)
-	go func() {
-		_, copyErr := io.Copy(destTLSConn, tlsClientConn)
-		if copyErr != nil && !errors.Is(copyErr, io.EOF) && !strings.Contains(copyErr.Error(), "use of closed network connection") {
-			log.Printf("Error copying client->dest for %s: %v", targetHost, copyErr)
-		} else {
-			copyErr = nil
-		}
-		errChan <- copyErr
-	}()
-	go func() {
-		_, copyErr := io.Copy(tlsClientConn, destTLSConn)
-		if copyErr != nil && !errors.Is(copyErr, io.EOF) && !strings.Contains(copyErr.Error(), "use of closed network connection") {
-			log.Printf("Error copying dest->client for %s: %v", targetHost, copyErr)
-		} else {
-			copyErr = nil
+	for _, encoding := range resp.TransferEncoding {
+		if encoding == "chunked" {
+			return true
 		}
-		errChan <- copyErr
-	}()
+	}
+
+	return false
+}
 
-	<-errChan
-	<-errChan
+func writeTunnelError(conn net.Conn, status int) {
+	_, err := fmt.Fprintf(conn, "HTTP/1.1 %d %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", status, http.StatusText(status))
+	if err != nil {
+		log.Printf("Failed to send %d to client %s: %v\n", status, conn.RemoteAddr(), err)
+	}
 }
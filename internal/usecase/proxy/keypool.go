@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	leafKeyRSA   = "rsa"
+	leafKeyECDSA = "ecdsa"
+)
+
+// The filler waits between failed generations, doubling the delay up to
+// maxKeyRetryDelay, instead of spinning on a broken entropy source; get
+// keeps generating on demand meanwhile.
+const (
+	minKeyRetryDelay = 100 * time.Millisecond
+	maxKeyRetryDelay = time.Minute
+)
+
+// keyPool keeps a number of freshly generated leaf keys ready so minting a
+// certificate for a new host does not have to wait for key generation.
+// Every key is handed out once.
+type keyPool struct {
+	keys     chan crypto.Signer
+	generate func() (crypto.Signer, error)
+}
+
+func newKeyPool(keyType string, size int) (*keyPool, error) {
+	var generate func() (crypto.Signer, error)
+
+	switch keyType {
+	case leafKeyRSA:
+		generate = func() (crypto.Signer, error) {
+			return rsa.GenerateKey(rand.Reader, rsaBits)
+		}
+	case leafKeyECDSA:
+		generate = func() (crypto.Signer, error) {
+			return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported leaf key type %q", keyType)
+	}
+
+	pool := &keyPool{
+		keys:     make(chan crypto.Signer, max(size, 0)),
+		generate: generate,
+	}
+
+	if size > 0 {
+		go pool.fill()
+	}
+
+	return pool, nil
+}
+
+func (p *keyPool) fill() {
+	delay := minKeyRetryDelay
+	for {
+		key, err := p.generate()
+		if err != nil {
+			log.Printf("Error pre-generating leaf key, retrying in %s: %v", delay, err)
+			time.Sleep(delay)
+			delay = min(delay*2, maxKeyRetryDelay)
+			continue
+		}
+		delay = minKeyRetryDelay
+		p.keys <- key
+	}
+}
+
+func (p *keyPool) get() (crypto.Signer, error) {
+	select {
+	case key := <-p.keys:
+		return key, nil
+	default:
+		return p.generate()
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeyPoolBacksOffOnErrors(t *testing.T) {
+	var calls, failing atomic.Int64
+	failing.Store(1)
+
+	pool := &keyPool{
+		keys: make(chan crypto.Signer, 1),
+		generate: func() (crypto.Signer, error) {
+			calls.Add(1)
+			if failing.Load() == 1 {
+				return nil, errors.New("entropy source unavailable")
+			}
+			return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		},
+	}
+	go pool.fill()
+
+	// 100ms, 200ms, 400ms: a spinning filler would make thousands of calls.
+	time.Sleep(500 * time.Millisecond)
+	if n := calls.Load(); n > 4 {
+		t.Fatalf("filler retried %d times in 500ms", n)
+	}
+
+	_, err := pool.get()
+	if err == nil {
+		t.Fatal("get succeeded while generation fails")
+	}
+
+	failing.Store(0)
+	select {
+	case key := <-pool.keys:
+		if key == nil {
+			t.Fatal("pool handed out a nil key")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("pool did not refill after generation recovered")
+	}
+}
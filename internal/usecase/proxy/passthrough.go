@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"path"
+	"regexp"
+	"simple_proxy/internal/config"
+	"strings"
+	"sync"
+	"time"
+)
+
+const regexRulePrefix = "re:"
+
+type passthroughRule struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func (r passthroughRule) matches(host string) bool {
+	if r.regex != nil {
+		return r.regex.MatchString(host)
+	}
+
+	matched, _ := path.Match(r.pattern, host)
+	return matched
+}
+
+type handshakeFailures struct {
+	count int
+	last  time.Time
+}
+
+// passthroughList decides which CONNECT hosts are tunneled without
+// decryption: hosts matching a configured rule, and hosts whose clients
+// keep rejecting the minted certificate, which usually means pinning.
+type passthroughList struct {
+	rules       []passthroughRule
+	maxFailures int
+	ttl         time.Duration
+
+	mutex     sync.Mutex
+	failures  map[string]*handshakeFailures
+	temporary map[string]time.Time
+	pruned    time.Time
+}
+
+func newPassthroughList(cfg config.TLSConfig) (*passthroughList, error) {
+	list := &passthroughList{
+		maxFailures: cfg.AutoPassthroughFailures,
+		ttl:         cfg.AutoPassthroughTTL,
+		failures:    make(map[string]*handshakeFailures),
+		temporary:   make(map[string]time.Time),
+	}
+
+	for _, pattern := range cfg.Passthrough {
+		rule := passthroughRule{pattern: strings.ToLower(pattern)}
+
+		if expr, ok := strings.CutPrefix(pattern, regexRulePrefix); ok {
+			regex, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid passthrough rule %q: %w", pattern, err)
+			}
+			rule.regex = regex
+		} else if _, err := path.Match(rule.pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid passthrough rule %q: %w", pattern, err)
+		}
+
+		list.rules = append(list.rules, rule)
+	}
+
+	return list, nil
+}
+
+func passthroughHost(target string) string {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+	return strings.ToLower(host)
+}
+
+// match reports whether target must not be intercepted and why.
+func (p *passthroughList) match(target string) (string, bool) {
+	host := passthroughHost(target)
+
+	for _, rule := range p.rules {
+		if rule.matches(host) {
+			return fmt.Sprintf("matches rule %q", rule.pattern), true
+		}
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	expires, ok := p.temporary[host]
+	if !ok {
+		return "", false
+	}
+	if time.Now().After(expires) {
+		delete(p.temporary, host)
+		log.Printf("Temporary passthrough for %s expired, intercepting again\n", host)
+		return "", false
+	}
+
+	return fmt.Sprintf("temporarily passed through until %s", expires.Format(time.TimeOnly)), true
+}
+
+// recordFailure counts a failed client handshake and moves the host to the
+// temporary passthrough list once failures repeat.
+func (p *passthroughList) recordFailure(target string) {
+	if p.maxFailures <= 0 {
+		return
+	}
+
+	host := passthroughHost(target)
+	now := time.Now()
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	failures, ok := p.failures[host]
+	if !ok || now.Sub(failures.last) > p.ttl {
+		p.prune(now)
+		failures = &handshakeFailures{}
+		p.failures[host] = failures
+	}
+	failures.count++
+	failures.last = now
+
+	if failures.count < p.maxFailures {
+		return
+	}
+
+	delete(p.failures, host)
+	p.temporary[host] = now.Add(p.ttl)
+	log.Printf("Client handshakes for %s failed %d times in a row, passing it through without interception for %s\n", host, p.maxFailures, p.ttl)
+}
+
+func (p *passthroughList) recordSuccess(target string) {
+	if p.maxFailures <= 0 {
+		return
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.failures, passthroughHost(target))
+}
+
+// prune drops failure counts and temporary passthroughs that have lapsed,
+// at most once per ttl, so hosts that fail only now and then do not
+// accumulate.
+func (p *passthroughList) prune(now time.Time) {
+	if now.Sub(p.pruned) < p.ttl {
+		return
+	}
+	p.pruned = now
+
+	for host, failures := range p.failures {
+		if now.Sub(failures.last) > p.ttl {
+			delete(p.failures, host)
+		}
+	}
+	for host, expires := range p.temporary {
+		if now.After(expires) {
+			delete(p.temporary, host)
+		}
+	}
+}
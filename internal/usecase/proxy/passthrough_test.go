@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"fmt"
+	"simple_proxy/internal/config"
+	"testing"
+	"time"
+)
+
+func TestPassthroughRuleMatches(t *testing.T) {
+	list, err := newPassthroughList(config.TLSConfig{
+		Passthrough: []string{"bank.example", "*.apple.com", `re:^api\d+\.pinned\.io$`, "Mixed.Case"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: "bank.example:443", want: true},
+		{target: "bank.example", want: true},
+		{target: "BANK.EXAMPLE:443", want: true},
+		{target: "www.bank.example:443", want: false},
+		{target: "itunes.apple.com:443", want: true},
+		{target: "apple.com:443", want: false},
+		{target: "api7.pinned.io:443", want: true},
+		{target: "api.pinned.io:443", want: false},
+		{target: "mixed.case:443", want: true},
+		{target: "example.org:443", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			_, got := list.match(tt.target)
+			if got != tt.want {
+				t.Errorf("match(%q) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassthroughInvalidRules(t *testing.T) {
+	for _, rule := range []string{"re:(", "[a-"} {
+		_, err := newPassthroughList(config.TLSConfig{Passthrough: []string{rule}})
+		if err == nil {
+			t.Errorf("rule %q was accepted", rule)
+		}
+	}
+}
+
+func TestPassthroughAfterRepeatedFailures(t *testing.T) {
+	list, err := newPassthroughList(config.TLSConfig{
+		AutoPassthroughFailures: 3,
+		AutoPassthroughTTL:      time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list.recordFailure("pinned.example:443")
+	list.recordFailure("pinned.example:443")
+	list.recordSuccess("pinned.example:443")
+	list.recordFailure("pinned.example:443")
+	list.recordFailure("pinned.example:443")
+	if _, ok := list.match("pinned.example:443"); ok {
+		t.Fatal("host passed through before failing 3 times in a row")
+	}
+
+	list.recordFailure("pinned.example:443")
+	if _, ok := list.match("pinned.example:443"); !ok {
+		t.Fatal("host not passed through after 3 failures in a row")
+	}
+
+	list.temporary["pinned.example"] = time.Now().Add(-time.Second)
+	if _, ok := list.match("pinned.example:443"); ok {
+		t.Error("temporary passthrough did not expire")
+	}
+}
+
+func TestPassthroughPrunesStaleFailures(t *testing.T) {
+	list, err := newPassthroughList(config.TLSConfig{
+		AutoPassthroughFailures: 3,
+		AutoPassthroughTTL:      time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := range 100 {
+		list.recordFailure(fmt.Sprintf("host%d.example:443", i))
+	}
+	list.temporary["expired.example"] = time.Now().Add(-time.Second)
+
+	// Age everything past the ttl, as if the failures happened long ago.
+	for _, failures := range list.failures {
+		failures.last = failures.last.Add(-2 * time.Minute)
+	}
+	list.pruned = list.pruned.Add(-2 * time.Minute)
+
+	list.recordFailure("fresh.example:443")
+
+	if len(list.failures) != 1 || list.failures["fresh.example"] == nil {
+		t.Errorf("%d failure entries left, want only the fresh one", len(list.failures))
+	}
+	if len(list.temporary) != 0 {
+		t.Errorf("expired temporary passthroughs kept: %v", list.temporary)
+	}
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"simple_proxy/internal/config"
+	"simple_proxy/internal/model"
+	"simple_proxy/internal/repository/memory"
+	"simple_proxy/internal/service/parser"
+	"testing"
+)
+
+func newTestService(repo Repository) *HttpProxyService {
+	transport := newUpstreamTransport(config.Default().Upstream)
+
+	return &HttpProxyService{
+		parser:           parser.NewHTTPParser(0),
+		repository:       repo,
+		transport:        transport,
+		client:           newUpstreamClient(transport, 0),
+		responseEncoding: responseEncodingPreserve,
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	var gotMethod, gotQuery, gotBody, gotHeader string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotMethod, gotQuery, gotBody, gotHeader = r.Method, r.URL.RawQuery, string(body), r.Header.Get("X-Test")
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("repeated"))
+	}))
+	defer upstream.Close()
+
+	ctx := context.Background()
+	repo := memory.NewHTTPRepository()
+	h := newTestService(repo)
+
+	original := &model.HTTPRequest{
+		Method:      http.MethodPost,
+		Scheme:      "http",
+		Path:        "/submit",
+		QueryParams: map[string][]string{"q": {"1"}},
+		Headers:     map[string][]string{"X-Test": {"yes"}, "Content-Length": {"999"}},
+		Body:        []byte{0x00, 0xff, 'b', 'i', 'n'},
+		TargetHost:  mustHost(t, upstream.URL),
+	}
+	err := repo.SaveRequest(ctx, original)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction, err := h.Repeat(ctx, original.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if gotMethod != http.MethodPost || gotQuery != "q=1" || gotHeader != "yes" {
+		t.Errorf("upstream got %s ?%s X-Test=%q", gotMethod, gotQuery, gotHeader)
+	}
+	if gotBody != string(original.Body) {
+		t.Errorf("upstream got body %q, want %q", gotBody, original.Body)
+	}
+	if transaction.Request.OriginalRequestID != original.ID {
+		t.Errorf("repeated request links to %s, want %s", transaction.Request.OriginalRequestID.Hex(), original.ID.Hex())
+	}
+
+	stored, err := repo.GetTransaction(ctx, transaction.Request.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Response == nil || string(stored.Response.Body) != "repeated" {
+		t.Fatalf("stored response = %+v, want body \"repeated\"", stored.Response)
+	}
+
+	requests, total, err := repo.ListRequests(ctx, model.RequestFilter{}, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || requests[0].ID != transaction.Request.ID {
+		t.Errorf("listing has %d requests, newest %s, want 2 with the repeat first", total, requests[0].ID.Hex())
+	}
+}
+
+func TestRepeatRejectsUnfaithfulReplays(t *testing.T) {
+	ctx := context.Background()
+	repo := memory.NewHTTPRepository()
+	h := newTestService(repo)
+
+	tests := []struct {
+		name    string
+		request *model.HTTPRequest
+	}{
+		{
+			name:    "truncated body",
+			request: &model.HTTPRequest{Method: http.MethodPost, TargetHost: "example.com", Body: []byte("cut"), BodySize: 10, BodyTruncated: true},
+		},
+		{
+			name:    "CONNECT",
+			request: &model.HTTPRequest{Method: http.MethodConnect, TargetHost: "example.com:443"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := repo.SaveRequest(ctx, tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = h.Repeat(ctx, tt.request.ID.Hex())
+			if !errors.Is(err, model.ErrUnsupported) {
+				t.Errorf("Repeat error = %v, want %v", err, model.ErrUnsupported)
+			}
+		})
+	}
+}
+
+func TestRepeatUnknownRequest(t *testing.T) {
+	h := newTestService(memory.NewHTTPRepository())
+
+	_, err := h.Repeat(context.Background(), "0123456789abcdef01234567")
+	if !errors.Is(err, model.ErrNotFound) {
+		t.Errorf("Repeat error = %v, want %v", err, model.ErrNotFound)
+	}
+
+	_, err = h.Repeat(context.Background(), "not-an-id")
+	if !errors.Is(err, model.ErrInvalidID) {
+		t.Errorf("Repeat error = %v, want %v", err, model.ErrInvalidID)
+	}
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Host
+}
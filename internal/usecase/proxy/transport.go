@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"simple_proxy/internal/config"
+	"time"
+)
+
+// newUpstreamTransport builds the single pooled transport every upstream
+// connection goes through, so keep-alive connections are reused across
+// forwarded requests, repeats and scans. Compression is left to the client's
+// own Accept-Encoding so responses arrive exactly as the server sent them.
+func newUpstreamTransport(cfg config.UpstreamConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   cfg.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		DisableCompression:    true,
+		TLSHandshakeTimeout:   cfg.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+		IdleConnTimeout:       cfg.IdleConnTimeout,
+		MaxIdleConns:          cfg.MaxIdleConns,
+		MaxIdleConnsPerHost:   cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:       cfg.MaxConnsPerHost,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+func newUpstreamClient(transport *http.Transport, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// dialUpstream opens a dedicated connection for traffic the pool cannot
+// carry, such as WebSockets and raw tunnels, with the same dial and
+// handshake limits.
+func (h *HttpProxyService) dialUpstream(ctx context.Context, addr string, tlsConfig *tls.Config) (net.Conn, error) {
+	conn, err := h.transport.DialContext(ctx, "tcp", addr)
+	if err != nil || tlsConfig == nil {
+		return conn, err
+	}
+
+	if h.transport.TLSHandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.transport.TLSHandshakeTimeout)
+		defer cancel()
+	}
+
+	tlsConn := tls.Client(conn, tlsConfig)
+	err = tlsConn.HandshakeContext(ctx)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return tlsConn, nil
+}
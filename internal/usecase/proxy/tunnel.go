@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"simple_proxy/internal/model"
+	"sync"
+	"time"
+)
+
+// tunnelPeekTimeout bounds how long a tunnel waits for the client to speak
+// first. Protocols where the server talks first (SMTP, FTP, ...) are
+// relayed as raw bytes once it expires.
+const tunnelPeekTimeout = 2 * time.Second
+
+const tlsRecordHandshake = 0x16
+
+var httpMethodPrefixes = [][]byte{
+	[]byte("GET "),
+	[]byte("HEAD "),
+	[]byte("POST "),
+	[]byte("PUT "),
+	[]byte("DELETE "),
+	[]byte("OPTIONS "),
+	[]byte("PATCH "),
+	[]byte("TRACE "),
+}
+
+// bufferedConn is a net.Conn whose first bytes have already been peeked into
+// reader.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// detectTunnelMode peeks at the first bytes the client sends through the
+// tunnel without consuming them.
+func detectTunnelMode(conn net.Conn, reader *bufio.Reader) model.TunnelMode {
+	conn.SetReadDeadline(time.Now().Add(tunnelPeekTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	first, err := reader.Peek(1)
+	if err != nil {
+		return model.TunnelRaw
+	}
+
+	if first[0] == tlsRecordHandshake {
+		return model.TunnelTLS
+	}
+
+	// The longest method prefix is "OPTIONS ", a shorter read is fine as
+	// long as it already contains a full one.
+	head, _ := reader.Peek(len("OPTIONS "))
+	for _, prefix := range httpMethodPrefixes {
+		if bytes.HasPrefix(head, prefix) {
+			return model.TunnelHTTP
+		}
+	}
+
+	return model.TunnelRaw
+}
+
+// relayTunnel copies bytes between the client and target without looking
+// at them and returns how many were sent in each direction.
+func (h *HttpProxyService) relayTunnel(ctx context.Context, clientConn net.Conn, clientReader *bufio.Reader, target string) (int64, int64) {
+	upstreamConn, err := h.dialUpstream(ctx, target, nil)
+	if err != nil {
+		log.Printf("Failed to connect to %s for raw tunnel: %v\n", target, err)
+		return 0, 0
+	}
+	defer upstreamConn.Close()
+
+	var sent, received int64
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		sent = copyTunnel(upstreamConn, clientReader, target)
+		closeWrite(upstreamConn)
+	}()
+
+	go func() {
+		defer wg.Done()
+		received = copyTunnel(clientConn, upstreamConn, target)
+		closeWrite(clientConn)
+	}()
+
+	wg.Wait()
+
+	log.Printf("Raw tunnel to %s closed: %d bytes sent, %d bytes received\n", target, sent, received)
+	return sent, received
+}
+
+func copyTunnel(dst io.Writer, src io.Reader, target string) int64 {
+	n, err := io.Copy(dst, src)
+	if err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Printf("Error relaying raw tunnel to %s: %v\n", target, err)
+	}
+	return n
+}
+
+// closeWrite half-closes TCP connections so the other side sees EOF while
+// the reverse direction keeps flowing.
+func closeWrite(conn net.Conn) {
+	if tcpConn, ok := conn.(interface{ CloseWrite() error }); ok {
+		tcpConn.CloseWrite()
+		return
+	}
+	conn.Close()
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"simple_proxy/internal/model"
+	"testing"
+	"time"
+)
+
+func TestDetectTunnelMode(t *testing.T) {
+	tests := []struct {
+		name  string
+		first string
+		want  model.TunnelMode
+	}{
+		{name: "tls client hello", first: "\x16\x03\x01\x02\x00\x01\x00\x01\xfc\x03\x03", want: model.TunnelTLS},
+		{name: "http get", first: "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n", want: model.TunnelHTTP},
+		{name: "http options", first: "OPTIONS * HTTP/1.1\r\n\r\n", want: model.TunnelHTTP},
+		{name: "method without space", first: "GETTING STARTED\r\n", want: model.TunnelRaw},
+		{name: "ssh", first: "SSH-2.0-OpenSSH_9.6\r\n", want: model.TunnelRaw},
+		{name: "short write", first: "OPT", want: model.TunnelRaw},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+
+			go func() {
+				client.Write([]byte(tt.first))
+				client.Close()
+			}()
+
+			reader := bufio.NewReader(server)
+			if got := detectTunnelMode(server, reader); got != tt.want {
+				t.Errorf("detectTunnelMode(%q) = %s, want %s", tt.first, got, tt.want)
+			}
+
+			// Detection only peeks, the relay still gets every byte.
+			data, _ := io.ReadAll(reader)
+			if string(data) != tt.first {
+				t.Errorf("read %q after detection, want %q", data, tt.first)
+			}
+		})
+	}
+}
+
+func TestDetectTunnelModeServerSpeaksFirst(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	reader := bufio.NewReader(server)
+	start := time.Now()
+	if got := detectTunnelMode(server, reader); got != model.TunnelRaw {
+		t.Errorf("detectTunnelMode on a silent client = %s, want %s", got, model.TunnelRaw)
+	}
+	if elapsed := time.Since(start); elapsed < tunnelPeekTimeout {
+		t.Errorf("gave up after %v, before the %v peek timeout", elapsed, tunnelPeekTimeout)
+	}
+
+	// The peek deadline must not outlive detection.
+	go client.Write([]byte("EHLO example.com\r\n"))
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "EHLO example.com\r\n" {
+		t.Errorf("read %q, %v after the peek timed out", line, err)
+	}
+}
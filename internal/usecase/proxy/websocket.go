@@ -0,0 +1,200 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"simple_proxy/internal/model"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/net/http/httpguts"
+)
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return httpguts.HeaderValuesContainsToken(r.Header["Connection"], "upgrade") &&
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// handleWebSocket forwards the upgrade handshake and, once the upstream
+// accepts it, relays frames in both directions until either side closes.
+// Frames are passed through unchanged; each complete message is recorded
+// against the handshake request.
+func (h *HttpProxyService) handleWebSocket(ctx context.Context, clientConn net.Conn, clientReader *bufio.Reader, r *http.Request) {
+	parsedRequest, capture := h.parser.ParseRequest(r)
+	capture.Finish()
+
+	err := h.repository.SaveRequest(ctx, parsedRequest)
+	if err != nil {
+		log.Printf("Error saving WebSocket handshake: %v\n", err)
+	}
+
+	upstreamConn, err := h.dialWebSocket(ctx, r.URL)
+	if err != nil {
+		log.Printf("%v to %s: %v\n", errForwardRequest, r.URL.Host, err)
+		writeTunnelError(clientConn, http.StatusServiceUnavailable)
+		return
+	}
+	defer upstreamConn.Close()
+
+	r.RequestURI = ""
+	r.Header.Del("Proxy-Connection")
+	// Extensions such as permessage-deflate would hide the payloads, so
+	// the proxy only offers plain frames.
+	r.Header.Del("Sec-WebSocket-Extensions")
+
+	log.Printf("Forwarding WebSocket handshake to %s\n", r.URL.String())
+
+	err = r.Write(upstreamConn)
+	if err != nil {
+		log.Printf("Error writing WebSocket handshake to %s: %v\n", r.URL.Host, err)
+		writeTunnelError(clientConn, http.StatusServiceUnavailable)
+		return
+	}
+
+	upstreamReader := bufio.NewReader(upstreamConn)
+	resp, err := http.ReadResponse(upstreamReader, r)
+	if err != nil {
+		log.Printf("Error reading WebSocket handshake response from %s: %v\n", r.URL.Host, err)
+		writeTunnelError(clientConn, http.StatusServiceUnavailable)
+		return
+	}
+
+	_, err = h.parser.ParseResponse(resp, parsedRequest.ID.Hex(), func(res *model.HTTPResponse) {
+		err := h.repository.SaveResponse(ctx, res)
+		if err != nil {
+			log.Printf("Error saving response: %v\n", err)
+		}
+	})
+	if err != nil {
+		log.Printf("Error parsing response: %v\n", err)
+	}
+
+	err = resp.Write(clientConn)
+	resp.Body.Close()
+	if err != nil {
+		log.Printf("Error writing WebSocket handshake response to %s: %v\n", clientConn.RemoteAddr(), err)
+		return
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		log.Printf("WebSocket upgrade to %s refused: %d\n", r.URL.Host, resp.StatusCode)
+		return
+	}
+
+	log.Printf("WebSocket to %s established\n", r.URL.Host)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		h.relayWebSocket(ctx, clientReader, upstreamConn, parsedRequest.ID, model.WebSocketClientToServer)
+		upstreamConn.Close()
+		clientConn.Close()
+	}()
+
+	go func() {
+		defer wg.Done()
+		h.relayWebSocket(ctx, upstreamReader, clientConn, parsedRequest.ID, model.WebSocketServerToClient)
+		clientConn.Close()
+		upstreamConn.Close()
+	}()
+
+	wg.Wait()
+
+	log.Printf("WebSocket to %s closed\n", r.URL.Host)
+}
+
+func (h *HttpProxyService) dialWebSocket(ctx context.Context, target *url.URL) (net.Conn, error) {
+	host := target.Host
+	if target.Port() == "" {
+		port := "80"
+		if target.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(target.Hostname(), port)
+	}
+
+	if target.Scheme != "https" {
+		return h.dialUpstream(ctx, host, nil)
+	}
+
+	return h.dialUpstream(ctx, host, &tls.Config{
+		ServerName: target.Hostname(),
+		NextProtos: []string{"http/1.1"},
+	})
+}
+
+// relayWebSocket copies frames from src to dst. Fragmented data messages
+// are reassembled before being stored, control frames are stored as they
+// arrive. Stored payloads are capped at the body limit.
+func (h *HttpProxyService) relayWebSocket(ctx context.Context, src *bufio.Reader, dst io.Writer, requestID primitive.ObjectID, direction model.WebSocketDirection) {
+	var message *model.WebSocketMessage
+
+	for {
+		frame, err := h.parser.ReadWebSocketFrame(src, dst)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Error relaying WebSocket frame (%s): %v\n", direction, err)
+			}
+			return
+		}
+
+		if frame.Opcode >= model.WebSocketOpClose {
+			h.saveWebSocketMessage(ctx, &model.WebSocketMessage{
+				RequestID: requestID,
+				Direction: direction,
+				Opcode:    frame.Opcode,
+				Payload:   frame.Payload,
+				Size:      frame.Length,
+				Truncated: frame.Truncated,
+			})
+			continue
+		}
+
+		if frame.Opcode != 0 || message == nil {
+			message = &model.WebSocketMessage{
+				RequestID: requestID,
+				Direction: direction,
+				Opcode:    frame.Opcode,
+			}
+		}
+
+		payload := frame.Payload
+		if room := h.bodyLimit - int64(len(message.Payload)); h.bodyLimit > 0 && int64(len(payload)) > room {
+			payload = payload[:max(room, 0)]
+			message.Truncated = true
+		}
+		message.Payload = append(message.Payload, payload...)
+		message.Size += frame.Length
+		message.Truncated = message.Truncated || frame.Truncated
+
+		if frame.Fin {
+			h.saveWebSocketMessage(ctx, message)
+			message = nil
+		}
+	}
+}
+
+func (h *HttpProxyService) saveWebSocketMessage(ctx context.Context, message *model.WebSocketMessage) {
+	message.Timestamp = time.Now()
+
+	if message.Opcode == model.WebSocketOpText && utf8.Valid(message.Payload) {
+		message.Text = string(message.Payload)
+	}
+
+	err := h.repository.SaveWebSocketMessage(ctx, message)
+	if err != nil {
+		log.Printf("Error saving WebSocket message for %s: %v\n", message.RequestID.Hex(), err)
+	}
+}